@@ -0,0 +1,76 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/schema"
+)
+
+// restartPolicies are the restart policies the container runtimes share.
+var restartPolicies = []string{"", "no", "on-failure", "always", "unless-stopped"}
+
+// ServiceDefinition is what a service package deploys instead of a shim: the
+// container please service start runs, as the manifest described it at
+// install time.
+type ServiceDefinition struct {
+	ContainerArgs   schema.ContainerArgs `json:"container_args"`
+	Service         schema.ServiceArgs   `json:"service"`
+	ApplicationArgs []string             `json:"application_args,omitempty"`
+	Image           string               `json:"image"`
+	Version         string               `json:"version"`
+	Digest          string               `json:"digest,omitempty"`
+	Platform        string               `json:"platform,omitempty"`
+	Executable      string               `json:"executable,omitempty"`
+}
+
+// Reference returns the image the service runs.
+func (d *ServiceDefinition) Reference() string {
+	return container.ImageReference(d.Image, d.Version, d.Digest)
+}
+
+// Validate checks the parts of the manifest the runtime would only reject
+// when the service is started.
+func (d *ServiceDefinition) Validate() error {
+	if !slices.Contains(restartPolicies, d.Service.Restart) {
+		return fmt.Errorf("invalid restart policy %q, expected one of %s", d.Service.Restart, strings.Join(restartPolicies[1:], ", "))
+	}
+	for _, volume := range d.Service.Volumes {
+		name, path, ok := strings.Cut(volume, ":")
+		if !ok || name == "" || !strings.HasPrefix(path, "/") || strings.ContainsAny(name, "/$~") {
+			return fmt.Errorf("invalid service volume %q, expected name:/path", volume)
+		}
+	}
+	if hc := d.Service.HealthCheck; hc != nil && hc.Command == "" {
+		return fmt.Errorf("health check without command")
+	}
+	return nil
+}
+
+func (d *ServiceDefinition) Deploy(path string) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal service definition: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadServiceDefinition reads a deployed service definition.
+func LoadServiceDefinition(path string) (*ServiceDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &ServiceDefinition{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal service definition: %w", err)
+	}
+	return d, nil
+}
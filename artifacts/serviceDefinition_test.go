@@ -0,0 +1,57 @@
+package artifacts
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestServiceDefinition(t *testing.T) {
+	def := &ServiceDefinition{
+		ContainerArgs: schema.ContainerArgs{ContainerEnvVars: map[string]string{"POSTGRES_PASSWORD": "please"}},
+		Service: schema.ServiceArgs{
+			Ports:       []string{"5432:5432"},
+			Volumes:     []string{"data:/var/lib/postgresql/data"},
+			HealthCheck: &schema.HealthCheck{Command: "pg_isready", Interval: "5s"},
+			Restart:     "unless-stopped",
+		},
+		Image:   "postgres",
+		Version: "16",
+		Digest:  "sha256:abc",
+	}
+
+	t.Run("deploy and load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "service.json")
+		if err := def.Deploy(path); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		loaded, err := LoadServiceDefinition(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(loaded, def) {
+			t.Errorf("expected %+v, got %+v", def, loaded)
+		}
+		if ref := loaded.Reference(); ref != "postgres@sha256:abc" {
+			t.Errorf("expected postgres@sha256:abc, got %s", ref)
+		}
+	})
+
+	invalid := map[string]func(s *schema.ServiceArgs){
+		"restart policy":           func(s *schema.ServiceArgs) { s.Restart = "sometimes" },
+		"bind mount as volume":     func(s *schema.ServiceArgs) { s.Volumes = []string{"$PWD:/data"} },
+		"volume without path":      func(s *schema.ServiceArgs) { s.Volumes = []string{"data"} },
+		"health check without cmd": func(s *schema.ServiceArgs) { s.HealthCheck = &schema.HealthCheck{Interval: "5s"} },
+	}
+	for name, edit := range invalid {
+		t.Run(name, func(t *testing.T) {
+			broken := *def
+			edit(&broken.Service)
+			if err := broken.Deploy(filepath.Join(t.TempDir(), "service.json")); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package artifacts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/utils"
+)
+
+var (
+	// shellSafe matches words bash takes literally without quotes
+	shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	envName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// shellQuote quotes s as a single bash word that is taken literally:
+// variables, command substitution, globs, quotes and whitespace alike.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return `"` + shellEscape(s) + `"`
+}
+
+// shellExpand quotes s as a single bash word like shellQuote, except for
+// the host variables of a path, $NAME, ${NAME} and a leading ~, which
+// expand. Manifests rely on them in volumes, the working directory and host
+// environment variables, e.g. $PWD:/work or ~/.kube/config.
+func shellExpand(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return `"` + utils.ExpandHostVars(s, func(name string) string { return "${" + name + "}" }, shellEscape) + `"`
+}
+
+// shellEscape escapes what bash would interpret inside double quotes.
+func shellEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '$', '"', '\\', '`':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// shellArgs quotes a group of runtime arguments, expanding host variables
+// only in groups that hold host paths.
+func shellArgs(group container.ArgGroup) string {
+	quote := shellQuote
+	if group.Expand {
+		quote = shellExpand
+	}
+	quoted := make([]string, len(group.Args))
+	for i, arg := range group.Args {
+		quoted[i] = quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellName returns name if it is a valid environment variable name.
+func shellName(name string) (string, error) {
+	if !envName.MatchString(name) {
+		return "", fmt.Errorf("invalid environment variable name %q", name)
+	}
+	return name, nil
+}
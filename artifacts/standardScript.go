@@ -1,71 +1,100 @@
 package artifacts
 
 import (
-	"html/template"
+	"bytes"
+	"fmt"
 	"os"
+	"text/template"
 
+	"github.com/arafat/please/container"
 	"github.com/arafat/please/schema"
 )
 
+// StandardScript is a shim that runs an application's image with the
+// selected container runtime.
 type StandardScript struct {
 	schema.ContainerArgs
+	Runtime         container.Runtime
 	HostEnvs        map[string]string
 	ApplicationArgs []string
 	Image           string
 	Version         string
+	Digest          string
 	Application     string
 	Platform        string
 	Executable      string
+	PassEnv         []string
 }
 
+// standardScriptTemplate renders the shim. Every interpolated value has to
+// pass through quote, expand or args, manifest values are not trusted to be
+// shell syntax. The terminal arguments of the runtime only apply if stdin and
+// stdout are terminals.
 const standardScriptTemplate = `#!/usr/bin/env bash
 {{- range $key, $value := .HostEnvs }}
-export {{ $key }}={{ $value }}
+export {{ name $key }}={{ expand $value }}
 {{- end }}
-exec container run -i --rm \
-{{- range .DNS }}
-  --dns {{.}} \
+{{- $groups := .RunArgs }}
+{{- range $groups }}
+{{- if .Terminal }}
+tty=()
+if [ -t 0 ] && [ -t 1 ]; then
+  tty=({{ args . }})
+fi
 {{- end }}
-{{- if .AdditionalFlags }}
-{{- range .AdditionalFlags }}
-  {{.}} \
 {{- end }}
-{{- end }}
-{{- range .Volumes }}
-  --volume {{.}} \
-{{- end }}
-{{- if .WorkDir }}
-  --workdir {{.WorkDir}} \
-{{- end }}
-  --platform {{.Platform}} \
-{{- range $key, $value := .ContainerEnvVars }}
-{{- if $value }}
-  -e {{ $key }}={{ $value }} \
-{{- end }}
-{{- end }}
-  {{.Image}}:{{.Version}} \
-{{- if .Executable }}
-  {{.Executable}} \
-{{- end }}
-{{- if .ApplicationArgs }}
-{{- range .ApplicationArgs }}
-  {{.}} \
+exec {{ quote .Runtime.Name }} \
+{{- range $groups }}
+{{- if .Terminal }}
+  "${tty[@]}" \
+{{- else }}
+  {{ args . }} \
 {{- end }}
 {{- end }}
   "$@"
 `
 
+// RunArgs renders the runtime arguments of the shim.
+func (s *StandardScript) RunArgs() []container.ArgGroup {
+	return s.Runtime.RunArgs(container.RunOptions{
+		ContainerArgs:   s.ContainerArgs,
+		Reference:       container.ImageReference(s.Image, s.Version, s.Digest),
+		Platform:        s.Platform,
+		Executable:      s.Executable,
+		ApplicationArgs: s.ApplicationArgs,
+		PassEnv:         s.PassEnv,
+	})
+}
+
 func (s *StandardScript) Deploy(path string) error {
-	tmpl, err := template.New("script").Parse(standardScriptTemplate)
+	switch s.TTY {
+	case "", schema.TTYAuto, schema.TTYAlways, schema.TTYNever:
+	default:
+		return fmt.Errorf("invalid tty mode %q, expected %s, %s or %s", s.TTY, schema.TTYAlways, schema.TTYNever, schema.TTYAuto)
+	}
+
+	tmpl, err := template.New("script").Funcs(template.FuncMap{
+		"quote":  shellQuote,
+		"expand": shellExpand,
+		"args":   shellArgs,
+		"name":   shellName,
+	}).Parse(standardScriptTemplate)
 	if err != nil {
 		return err
 	}
 
+	// Render first so that an invalid manifest leaves no half written shim
+	var script bytes.Buffer
+	if err := tmpl.Execute(&script, s); err != nil {
+		return err
+	}
+
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return tmpl.Execute(f, s)
+	_, err = f.Write(script.Bytes())
+	return err
 }
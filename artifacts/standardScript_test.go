@@ -0,0 +1,236 @@
+package artifacts
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/schema"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fakeDocker puts a docker binary on PATH that prints each argument it is
+// called with on a line of its own.
+func fakeDocker(t *testing.T) container.Runtime {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor arg in \"$@\"; do printf '%s\\n' \"$arg\"; done\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	rt, err := container.NewRuntime("docker")
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return rt
+}
+
+func trickyScript(rt container.Runtime) *StandardScript {
+	return &StandardScript{
+		ContainerArgs: schema.ContainerArgs{
+			DNS:             []string{"1.1.1.1; rm -rf /"},
+			AdditionalFlags: []string{"--label=owner=o'brien", "--label=cmd=`id`"},
+			Volumes:         []string{"$PWD:/work", "${HOME}/.cache:/root/.cache", "~/my dir:/data"},
+			WorkDir:         "/work dir",
+			ContainerEnvVars: map[string]string{
+				"HOMEDIR": "$HOME",
+				"PRICE":   "$5 & up",
+				"QUERY":   `a "quoted" \ value`,
+			},
+		},
+		Runtime: rt,
+		HostEnvs: map[string]string{
+			"FOO":        "a&b",
+			"GREETING":   "hello world",
+			"KUBECONFIG": "~/.kube/config",
+			"SUBST":      "$(whoami)",
+		},
+		ApplicationArgs: []string{"--format", "{{json .}}", "*.txt", "~/$USER"},
+		Image:           "alpine/helm",
+		Version:         "3.14.0",
+		Executable:      "helm",
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	rt := fakeDocker(t)
+
+	tests := []struct {
+		name   string
+		script *StandardScript
+	}{
+		{
+			name: "plain",
+			script: &StandardScript{
+				ContainerArgs: schema.ContainerArgs{Volumes: []string{"$PWD:/work"}, WorkDir: "/work"},
+				Runtime:       rt,
+				HostEnvs:      map[string]string{"KUBECONFIG": "/etc/kube/config"},
+				Image:         "alpine/helm",
+				Version:       "3.14.0",
+				Digest:        "sha256:abc",
+				Executable:    "helm",
+				PassEnv:       []string{"TERM"},
+			},
+		},
+		{
+			name:   "tricky",
+			script: trickyScript(rt),
+		},
+		{
+			name: "tty-always",
+			script: &StandardScript{
+				ContainerArgs: schema.ContainerArgs{TTY: schema.TTYAlways},
+				Runtime:       rt,
+				Image:         "jesseduffield/lazygit",
+				Version:       "0.40.2",
+			},
+		},
+		{
+			name: "tty-never",
+			script: &StandardScript{
+				ContainerArgs: schema.ContainerArgs{TTY: schema.TTYNever},
+				Runtime:       rt,
+				Image:         "stedolan/jq",
+				Version:       "1.7",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "shim.sh")
+			if err := tt.script.Deploy(path); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("expected shim, got %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("expected\n%s\ngot\n%s", expected, got)
+			}
+		})
+	}
+
+	// Without a terminal on stdin and stdout, as here, auto mode adds no -t
+	t.Run("values reach the runtime unchanged", func(t *testing.T) {
+		if _, err := exec.LookPath("bash"); err != nil {
+			t.Skip("bash not available")
+		}
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "shim.sh")
+		if err := trickyScript(rt).Deploy(path); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cmd := exec.Command(path, "extra arg")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME=/home/me", "PWD="+dir)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("expected shim to run, got %v", err)
+		}
+
+		expected := []string{
+			"run", "-i", "--rm",
+			"--dns", "1.1.1.1; rm -rf /",
+			"--label=owner=o'brien",
+			"--label=cmd=`id`",
+			"--volume", dir + ":/work",
+			"--volume", "/home/me/.cache:/root/.cache",
+			"--volume", "/home/me/my dir:/data",
+			"--workdir", "/work dir",
+			"-e", "HOMEDIR=$HOME",
+			"-e", "PRICE=$5 & up",
+			"-e", `QUERY=a "quoted" \ value`,
+			"alpine/helm:3.14.0",
+			"helm",
+			"--format", "{{json .}}", "*.txt", "~/$USER",
+			"extra arg",
+		}
+		got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+	})
+
+	t.Run("invalid tty mode", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "shim.sh")
+		script := &StandardScript{ContainerArgs: schema.ContainerArgs{TTY: "sometimes"}, Runtime: rt, Image: "alpine", Version: "3"}
+		if err := script.Deploy(path); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("invalid environment variable name", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "shim.sh")
+		script := &StandardScript{Runtime: rt, HostEnvs: map[string]string{"FOO;id": "1"}, Image: "alpine", Version: "3"}
+		if err := script.Deploy(path); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected no shim to be written, got %v", err)
+		}
+	})
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"helm":          "helm",
+		"":              `""`,
+		"--dns=1.1.1.1": "--dns=1.1.1.1",
+		"a&b":           `"a&b"`,
+		"hello world":   `"hello world"`,
+		"$PWD:/work":    `"\$PWD:/work"`,
+		"~/.kube":       `"~/.kube"`,
+		"$(whoami)":     `"\$(whoami)"`,
+		"`id`":          "\"\\`id\\`\"",
+		`say "hi"`:      `"say \"hi\""`,
+		`back\slash`:    `"back\\slash"`,
+	}
+	for input, expected := range tests {
+		if got := shellQuote(input); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+}
+
+func TestShellExpand(t *testing.T) {
+	tests := map[string]string{
+		"/work":          "/work",
+		"$PWD:/work":     `"${PWD}:/work"`,
+		"${HOME}/.cache": `"${HOME}/.cache"`,
+		"~/.kube":        `"${HOME}/.kube"`,
+		"~":              `"${HOME}"`,
+		"a~b":            `"a~b"`,
+		"$(whoami)":      `"\$(whoami)"`,
+		"$5":             `"\$5"`,
+		"${HOME:-/root}": `"\${HOME:-/root}"`,
+		"$HOME/my dir":   `"${HOME}/my dir"`,
+		`$HOME/"x"`:      `"${HOME}/\"x\""`,
+	}
+	for input, expected := range tests {
+		if got := shellExpand(input); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+}
@@ -10,7 +10,8 @@ import (
 var ActivateCmd = &cobra.Command{
 	Use:   "activate <bundle>",
 	Short: "activate bundle",
-	Long:  "activate bundle",
+	Long: `Activates the bundle globally: its packages are linked into ~/.please/bin for
+every terminal. Use please shell <bundle> to use a bundle in one shell only.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
 			fmt.Println("Usage: please activate <bundle>")
@@ -27,7 +28,8 @@ var ActivateCmd = &cobra.Command{
 
 		bDefs, err := environment.LoadBundleDefinitions(env)
 		if err != nil {
-			fmt.Printf("Error loading bundle definitions: %v", err)
+			fmt.Printf("Error loading bundle definitions: %v\n", err)
+			return
 		}
 
 		if !bDefs.BundleExists(bundleName) {
@@ -35,59 +37,31 @@ var ActivateCmd = &cobra.Command{
 			return
 		}
 
-		if err := cleanupCurrentBundle(env, bDefs); err != nil {
-			fmt.Printf("Error cleaning up current bundle: %v\n", err)
-		}
+		previous := bDefs.GetDefaultBundle()
+		bDefs.SetActiveBundle(bundleName)
 
-		bundle, err := activateBundle(bundleName, env)
+		missing, skipped, err := env.ActivateBundle(bDefs, bundleName)
 		if err != nil {
 			fmt.Printf("Error activating bundle %q: %v\n", bundleName, err)
 			return
 		}
+		for _, m := range missing {
+			fmt.Printf("Warning: %s from bundle [%s] is not installed\n", m, bundleName)
+		}
+		for _, s := range skipped {
+			fmt.Printf("Warning: %s from bundle [%s] is not linked\n", s, bundleName)
+		}
 
-		if err := bundle.SaveBundle(env); err != nil {
-			fmt.Printf("Error saving bundle: %v", err)
+		if err := bDefs.SaveBundle(env); err != nil {
+			fmt.Printf("Error saving bundle: %v\n", err)
+			// Put the links of the still recorded bundle back
+			bDefs.SetActiveBundle(previous)
+			if _, _, err := env.ActivateBundle(bDefs, previous); err != nil {
+				fmt.Printf("Error restoring bundle %q: %v\n", previous, err)
+			}
 			return
 		}
 
 		fmt.Printf("✅ Switched to bundle %q\n", bundleName)
 	},
 }
-
-func cleanupCurrentBundle(env *environment.Environment, bDefs *environment.Bundle) error {
-	ma := environment.NewManifestArchive(env.ManifestCoreFile)
-	bundleName := bDefs.GetActiveBundle()
-	toBeRemovedPkgs := bDefs.GetInstalledPackages(bundleName)
-	for pkg, _ := range toBeRemovedPkgs {
-		pm, err := ma.ExactMatch(pkg)
-		if err != nil {
-			return fmt.Errorf("Error finding package %q: %w", pkg, err)
-		}
-		env.DeleteSymlink(pm.Exec)
-	}
-
-	return nil
-}
-
-func activateBundle(bundleName string, env *environment.Environment) (*environment.Bundle, error) {
-	bDefs, err := environment.LoadBundleDefinitions(env)
-	if err != nil {
-		return nil, fmt.Errorf("Error loading bundle definitions: %w", err)
-	}
-
-	ma := environment.NewManifestArchive(env.ManifestCoreFile)
-	bDefs.SetActiveBundle(bundleName)
-	packages := bDefs.GetInstalledPackages(bundleName)
-	for pkg, version := range packages {
-		pm, err := ma.ExactMatch(pkg)
-		if err != nil {
-			return nil, fmt.Errorf("Error finding package %q: %w", pkg, err)
-		}
-
-		if err := env.CreateSymlink(pkg, pm.Exec, version); err != nil {
-			return nil, fmt.Errorf("Error creating symlink for %q: %w", pkg, err)
-		}
-	}
-
-	return bDefs, nil
-}
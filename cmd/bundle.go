@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/arafat/please/environment"
+	"github.com/arafat/please/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleExportOutput  string
+	bundleImportAs      string
+	bundleImportInstall bool
+	bundleAddExtends    []string
+	bundleAddDesc       string
+)
+
+func init() {
+	bundleExportCmd.Flags().StringVarP(&bundleExportOutput, "output", "o", "", "Write the export to a file instead of stdout")
+	bundleImportCmd.Flags().StringVar(&bundleImportAs, "as", "", "Name of the created bundle instead of the exported name")
+	bundleImportCmd.Flags().BoolVar(&bundleImportInstall, "install", false, "Pull and install every package of the bundle")
+
+	bundleAddCmd.Flags().StringSliceVar(&bundleAddExtends, "extends", nil, "Bundles whose packages the new bundle inherits, later ones override earlier ones")
+	bundleAddCmd.Flags().StringVarP(&bundleAddDesc, "desc", "d", "", "Description of the bundle")
+
+	BundleCmd.AddCommand(bundleAddCmd)
+	BundleCmd.AddCommand(bundleExportCmd)
+	BundleCmd.AddCommand(bundleImportCmd)
+	BundleCmd.AddCommand(bundleCloneCmd)
+	BundleCmd.AddCommand(bundleRenameCmd)
+	BundleCmd.AddCommand(bundleDescribeCmd)
+	BundleCmd.AddCommand(bundleDiffCmd)
+}
+
+var BundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Manages bundles",
+	Long:  "Shares bundles between machines and manages their definitions",
+}
+
+var bundleAddCmd = &cobra.Command{
+	Use:   "add <bundle>",
+	Short: "Adds a new bundle",
+	Long: `Adds a new bundle. With --extends the bundle inherits the packages of other
+bundles, such as a shared base toolchain; packages installed into the new
+bundle override inherited ones.
+
+  please bundle add platform --extends base -d "Platform team tools"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		bundleName := args[0]
+		editBundles(func(bundle *environment.Bundle) error {
+			if err := bundle.AddBundle(bundleName, bundleAddDesc); err != nil {
+				return err
+			}
+			if len(bundleAddExtends) == 0 {
+				return nil
+			}
+			return bundle.SetExtends(bundleName, bundleAddExtends)
+		})
+
+		if len(bundleAddExtends) > 0 {
+			fmt.Printf("✅ Successfully created bundle [%s] extending %s\n", bundleName, strings.Join(bundleAddExtends, ", "))
+			return
+		}
+		fmt.Printf("✅ Successfully created bundle [%s]\n", bundleName)
+	},
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export <bundle>",
+	Short: "Exports a bundle for sharing",
+	Long: `Writes the packages of a bundle with their versions, namespaces, pinned digests
+and constraints as a JSON document that please bundle import reads.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		doc, err := bundle.ExportBundle(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		data = append(data, '\n')
+
+		if bundleExportOutput == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(bundleExportOutput, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing export: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Exported bundle [%s] to %s\n", args[0], bundleExportOutput)
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <file|url>",
+	Short: "Creates a bundle from an export",
+	Long: `Creates a bundle from a document written by please bundle export, read from a
+file or an http(s) URL. Every package is checked against the cached manifests
+first. With --install the packages are pulled and installed right away, from
+their pinned digests where the export has them.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		doc, err := readBundleExport(e, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		bundleName := doc.Name
+		if bundleImportAs != "" {
+			bundleName = bundleImportAs
+		}
+		if err := environment.ValidateBundleName(bundleName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+		if bundle.BundleExists(bundleName) {
+			fmt.Fprintf(os.Stderr, "Error: bundle %q already exists, choose another name with --as\n", bundleName)
+			os.Exit(1)
+		}
+
+		resolver, err := environment.NewManifestResolver(e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		manifests, err := validateBundleExport(resolver, doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: bundle [%s] cannot be imported:\n%v\n", doc.Name, err)
+			os.Exit(1)
+		}
+
+		if !bundleImportInstall {
+			if err := bundle.ImportBundle(doc, bundleName); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if err := bundle.SaveBundle(e); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving bundle: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✅ Imported bundle [%s] with %d package version(s), import it with --install to install them\n", bundleName, len(doc.Packages))
+			return
+		}
+
+		regClient := e.RegistryClient()
+		op, err := e.BeginOperation("import", bundleName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for i := range doc.Packages {
+			pkg := &doc.Packages[i]
+			ma, pm := manifests[i].archive, manifests[i].manifest
+
+			if err := op.Creates(pkg.Name, pkg.Version); err != nil {
+				abortOperation(op, err)
+			}
+			if pkg.Digest == "" {
+				if pkg.Digest, err = resolveDigest(context.TODO(), regClient, pm, pkg.Version, "", false); err != nil {
+					abortOperation(op, err)
+				}
+			}
+			if err := deployPackage(e, ma, pm, pkg.Name, pkg.Version, pkg.Digest); err != nil {
+				abortOperation(op, fmt.Errorf("%s:%s: %w", pkg.Name, pkg.Version, err))
+			}
+			fmt.Printf("✅ Installed %s:%s\n", pkg.Name, pkg.Version)
+		}
+
+		if err := bundle.ImportBundle(doc, bundleName); err != nil {
+			abortOperation(op, err)
+		}
+		if err := op.Commit(bundle); err != nil {
+			abortOperation(op, fmt.Errorf("Error saving bundle: %w", err))
+		}
+		finishOperation(op)
+
+		fmt.Printf("✅ Imported and installed bundle [%s], run please activate %s to use it\n", bundleName, bundleName)
+	},
+}
+
+var bundleCloneCmd = &cobra.Command{
+	Use:   "clone <source> <destination>",
+	Short: "Copies a bundle",
+	Long: `Creates a bundle with the description, packages and pinned digests of another.
+The versions are shared, nothing is installed again.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		editBundles(func(bundle *environment.Bundle) error {
+			return bundle.CloneBundle(args[0], args[1])
+		})
+		fmt.Printf("✅ Cloned bundle [%s] to [%s]\n", args[0], args[1])
+	},
+}
+
+var bundleRenameCmd = &cobra.Command{
+	Use:   "rename <bundle> <new name>",
+	Short: "Renames a bundle",
+	Long: `Renames a bundle. The active bundle stays active under its new name. A bundle
+whose services keep volumes cannot be renamed, the volumes are named after it.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := editBundles(func(bundle *environment.Bundle) error {
+			// The containers and volumes of services are named after the bundle
+			env := environment.New()
+			if err := checkServicesStopped(env, args[0], ""); err != nil {
+				return err
+			}
+			volumes, err := serviceVolumes(env, bundle, args[0])
+			if err != nil {
+				return err
+			}
+			if len(volumes) > 0 {
+				return fmt.Errorf("the services of bundle [%s] keep the volumes %s, which would be orphaned by the rename", args[0], strings.Join(volumes, ", "))
+			}
+			return bundle.RenameBundle(args[0], args[1])
+		})
+		e.RemoveBundleBin(args[0])
+		fmt.Printf("✅ Renamed bundle [%s] to [%s]\n", args[0], args[1])
+	},
+}
+
+var bundleDescribeCmd = &cobra.Command{
+	Use:   "describe <bundle> <description>",
+	Short: "Sets the description of a bundle",
+	Long:  "Sets the description of a bundle shown by please show bundle, an empty description removes it.",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		editBundles(func(bundle *environment.Bundle) error {
+			return bundle.SetDescription(args[0], strings.Join(args[1:], " "))
+		})
+		fmt.Printf("✅ Updated the description of bundle [%s]\n", args[0])
+	},
+}
+
+var bundleDiffCmd = &cobra.Command{
+	Use:   "diff <bundle> <bundle>",
+	Short: "Compares the packages of two bundles",
+	Long: `Lists the packages the second bundle adds (+), lacks (-) or has in another
+version (~) compared to the first.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		changes, err := bundle.DiffBundles(args[0], args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(changes) == 0 {
+			fmt.Printf("Bundles [%s] and [%s] contain the same packages\n", args[0], args[1])
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range changes {
+			from, to := strings.Join(c.From, ", "), strings.Join(c.To, ", ")
+			switch {
+			case from == "":
+				fmt.Fprintf(w, "+ %s\t%s\n", c.Package, to)
+			case to == "":
+				fmt.Fprintf(w, "- %s\t%s\n", c.Package, from)
+			default:
+				fmt.Fprintf(w, "~ %s\t%s → %s\n", c.Package, from, to)
+			}
+		}
+		w.Flush()
+	},
+}
+
+// editBundles applies edit to the bundle definitions and saves them, exiting
+// on failure.
+func editBundles(edit func(bundle *environment.Bundle) error) *environment.Environment {
+	e := environment.New()
+
+	bundle, err := environment.LoadBundleDefinitions(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+		os.Exit(1)
+	}
+	if err := edit(bundle); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := bundle.SaveBundle(e); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving bundle definitions: %v\n", err)
+		os.Exit(1)
+	}
+	return e
+}
+
+// readBundleExport reads an export from a file or an http(s) URL.
+func readBundleExport(e *environment.Environment, source string) (*schema.BundleExport, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := e.HTTPClient().Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", source, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download %s: %s", source, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	return environment.ReadBundleExport(r)
+}
+
+type resolvedManifest struct {
+	archive  *environment.ManifestArchive
+	manifest *schema.PackageManifest
+}
+
+// validateBundleExport resolves every package of doc in the manifest cache,
+// recording the namespace of packages exported without one. Unknown packages
+// and versions are reported together.
+func validateBundleExport(resolver *environment.ManifestResolver, doc *schema.BundleExport) ([]resolvedManifest, error) {
+	manifests := make([]resolvedManifest, len(doc.Packages))
+	var errs []error
+	for i := range doc.Packages {
+		pkg := &doc.Packages[i]
+
+		ma, pm, err := resolver.Resolve(pkg.Namespace, pkg.Name)
+		if err != nil {
+			if suggestions := resolver.Suggest(pkg.Name); len(suggestions) > 0 {
+				err = fmt.Errorf("%w, did you mean %s?", err, strings.Join(suggestions, ", "))
+			}
+			errs = append(errs, fmt.Errorf("  %s: %w", pkg.Name, err))
+			continue
+		}
+		if err := environment.ValidateVersion(pkg.Version); err != nil {
+			errs = append(errs, fmt.Errorf("  %s: %w", pkg.Name, err))
+			continue
+		}
+		if len(pm.Versions) > 0 && !slices.Contains(pm.Versions, pkg.Version) {
+			errs = append(errs, fmt.Errorf("  %s: version %q is not available", pkg.Name, pkg.Version))
+			continue
+		}
+
+		if pkg.Namespace == "" {
+			pkg.Namespace = ma.Namespace
+		}
+		manifests[i] = resolvedManifest{ma, pm}
+	}
+	return manifests, errors.Join(errs...)
+}
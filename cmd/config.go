@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/arafat/please/config"
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+var configProjectFlag bool
+
+func init() {
+	configSetCmd.Flags().BoolVar(&configProjectFlag, "project", false, "Write to the project's "+config.ProjectFileName+" instead of the global configuration")
+
+	ConfigCmd.AddCommand(configGetCmd)
+	ConfigCmd.AddCommand(configSetCmd)
+	ConfigCmd.AddCommand(configListCmd)
+}
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Reads and edits the please configuration",
+	Long: `Reads and edits ~/.please/config.toml. A ` + config.ProjectFileName + ` in the current
+directory or one of its parents overrides install.prompt and platform, it
+cannot set any other key.`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Prints the effective value of a setting",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+		if e.ConfigErr != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", e.ConfigErr)
+			os.Exit(1)
+		}
+
+		value, err := e.Config.Get(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Sets a setting, an empty value restores its default",
+	Long: `Sets a setting after validating it. Lists such as shim.extra_flags are given
+comma separated, durations such as http.timeout as 30s or 2m.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		path := e.ConfigPath()
+		if configProjectFlag {
+			if !config.IsProjectKey(args[0]) {
+				fmt.Fprintf(os.Stderr, "Error: %q cannot be set in %s\n", args[0], config.ProjectFileName)
+				os.Exit(1)
+			}
+			workDir, err := os.Getwd()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if path, err = config.FindProjectFile(workDir); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if path == "" {
+				path = filepath.Join(workDir, config.ProjectFileName)
+			}
+		}
+
+		if err := config.Set(path, args[0], args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s = %q written to %s\n", args[0], args[1], path)
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the effective settings",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+		if e.ConfigErr != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", e.ConfigErr)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, key := range config.Keys() {
+			value, _ := e.Config.Get(key)
+			fmt.Fprintf(w, "%s\t%s\n", key, value)
+		}
+		w.Flush()
+	},
+}
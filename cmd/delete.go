@@ -4,14 +4,23 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/arafat/please/artifacts"
+	"github.com/arafat/please/container"
 	"github.com/arafat/please/environment"
 	"github.com/arafat/please/utils"
 	"github.com/spf13/cobra"
 )
 
+var deleteImageFlag bool
+
 func init() {
+	for _, cmd := range []*cobra.Command{DeleteCmd, deletePackageCmd} {
+		cmd.Flags().BoolVar(&deleteImageFlag, "image", false, "Also remove the container image once no bundle uses the version anymore")
+	}
+
 	DeleteCmd.AddCommand(deleteBundleCmd)
 	DeleteCmd.AddCommand(deletePackageCmd)
 }
@@ -36,6 +45,10 @@ var deleteBundleCmd = &cobra.Command{
 			return
 		}
 
+		if err := checkServicesStopped(env, bundleName, ""); err != nil {
+			fmt.Printf("Error deleting bundle %q: %v\n", bundleName, err)
+			return
+		}
 		if err := bDefs.DeleteBundle(bundleName); err != nil {
 			fmt.Printf("Error deleting bundle %q: %v\n", bundleName, err)
 			return
@@ -45,72 +58,20 @@ var deleteBundleCmd = &cobra.Command{
 			fmt.Printf("Error saving bundle definitions: %v\n", err)
 			return
 		}
+		env.RemoveBundleBin(bundleName)
 
 		fmt.Printf("✅ Bundle %q deleted successfully.\n", bundleName)
+		fmt.Println("Run please gc to remove the versions no other bundle uses")
 	},
 }
 
 var deletePackageCmd = &cobra.Command{
-	Use:   "package <pkg>",
+	Use:   "package <pkg>[@version]",
 	Short: "Delete the package",
-	Long:  "Delete the package <pkg> from the currently active bundle",
+	Long:  "Delete the package <pkg> from the currently active bundle, or only one of its versions with <pkg>@<version>",
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		pkg := args[0]
-		e := environment.New()
-		e.Initialize()
-
-		ma := environment.NewManifestArchive(e.ManifestCoreFile)
-		pm, err := ma.ExactMatch(pkg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error finding package:%v", err)
-			return
-		}
-
-		bundle, err := environment.LoadBundleDefinitions(e)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading bundle definitions:%v", err)
-			return
-		}
-
-		version, err := bundle.GetPackageVersion(pkg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting package version:%v", err)
-			return
-		}
-
-		replacer := utils.MakeRuntimeReplacer(version)
-		replacer(pm.ContainerArgs.ContainerEnvVars)
-		replacer(pm.HostEnvVars)
-
-		e.DeleteSymlink(pm.Exec)
-		e.DeleteArtifact(pkg, version)
-
-		// Delete the package from the bundle
-		if err := bundle.DeletePackage(pkg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error deleting package:%v", err)
-			return
-		}
-
-		// Save the updated bundle
-		if err := bundle.SaveBundle(e); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving bundle:%v", err)
-			return
-		}
-
-		hooks, err := ma.LoadScriptHooksFromManifest(pkg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading script hooks: %v\n", err)
-			return
-		}
-
-		preHook := artifacts.NewShellHook(hooks.PostHook, pm.HostEnvVars)
-		if err := preHook.Execute(context.TODO()); err != nil {
-			fmt.Fprintf(os.Stderr, "Error executing post-hook: %v\n", err)
-			return
-		}
-
-		fmt.Printf("✅ Package '%s' deleted successfully from bundle [%s]\n", pkg, bundle.GetActiveBundle())
+		deletePackage(args[0])
 	},
 }
 
@@ -125,60 +86,155 @@ var DeleteCmd = &cobra.Command{
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		pkg := args[0]
-		e := environment.New()
-		e.Initialize()
-
-		ma := environment.NewManifestArchive(e.ManifestCoreFile)
-		pm, err := ma.ExactMatch(pkg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error finding package:%v", err)
-			return
-		}
-
-		bundle, err := environment.LoadBundleDefinitions(e)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading bundle definitions:%v", err)
-			return
-		}
-
-		version, err := bundle.GetPackageVersion(pkg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting package version:%v", err)
-			return
-		}
-
-		replacer := utils.MakeRuntimeReplacer(version)
-		replacer(pm.ContainerArgs.ContainerEnvVars)
-		replacer(pm.HostEnvVars)
-
-		e.DeleteSymlink(pm.Exec)
-		e.DeleteArtifact(pkg, version)
-
-		// Delete the package from the bundle
-		if err := bundle.DeletePackage(pkg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error deleting package:%v", err)
-			return
-		}
-
-		// Save the updated bundle
-		if err := bundle.SaveBundle(e); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving bundle:%v", err)
-			return
-		}
+		deletePackage(args[0])
+	},
+}
 
-		hooks, err := ma.LoadScriptHooksFromManifest(pkg)
+func deletePackage(identifier string) {
+	_, pkg, only := parseIdentifier(identifier)
+
+	e := environment.New()
+	e.Initialize()
+
+	bundle, err := environment.LoadBundleDefinitions(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading bundle definitions:%v", err)
+		return
+	}
+
+	if _, err := bundle.GetPackageVersion(pkg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting package version:%v", err)
+		return
+	}
+	versions := bundle.GetPackageVersions(bundle.GetActiveBundle(), pkg)
+	if only != "" {
+		if !slices.Contains(versions, only) {
+			fmt.Fprintf(os.Stderr, "Error: bundle [%s] does not contain %s:%s\n", bundle.GetActiveBundle(), pkg, only)
+			return
+		}
+		versions = []string{only}
+	}
+	version := versions[0]
+
+	resolver, err := environment.NewManifestResolver(e)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	ma, pm, err := resolver.ResolveInstalled(bundle, bundle.GetActiveBundle(), pkg, version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding package:%v", err)
+		return
+	}
+
+	replacer := utils.MakeRuntimeReplacer(version)
+	replacer(pm.ContainerArgs.ContainerEnvVars)
+	replacer(pm.HostEnvVars)
+
+	digests := make(map[string]string, len(versions))
+	for _, v := range versions {
+		digests[v] = bundle.GetPackageDigest(bundle.GetActiveBundle(), pkg, v)
+	}
+
+	if err := checkServicesStopped(e, bundle.GetActiveBundle(), pkg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+
+	op, err := e.BeginOperation("delete", bundle.GetActiveBundle())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+
+	// Delete the package, or the one version, from the bundle
+	if only != "" {
+		err = bundle.DeletePackageVersion(pkg, only)
+	} else {
+		err = bundle.DeletePackage(pkg)
+	}
+	if err != nil {
+		abortOperation(op, fmt.Errorf("Error deleting package:%w", err))
+	}
+
+	// A version is shared with other bundles and projects, only the last
+	// one to let go of it removes it
+	var unused []string
+	for _, v := range versions {
+		references, err := e.ArtifactReferences(bundle, environment.Artifact{Package: pkg, Version: v})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading script hooks: %v\n", err)
-			return
-		}
+			abortOperation(op, err)
+		}
+		if len(references) > 0 {
+			fmt.Printf("Keeping %s:%s, it is still used by %s\n", pkg, v, strings.Join(references, ", "))
+			continue
+		}
+		if err := op.Obsoletes(pkg, v); err != nil {
+			abortOperation(op, err)
+		}
+		unused = append(unused, v)
+	}
+
+	// Save the updated bundle, the artifact is only removed afterwards
+	if err := op.Commit(bundle); err != nil {
+		abortOperation(op, fmt.Errorf("Error saving bundle:%w", err))
+	}
+	finishOperation(op)
+	relinkBundle(e, bundle)
+
+	if deleteImageFlag {
+		for _, v := range unused {
+			removeImage(e, container.ImageReference(pm.Image, v, digests[v]))
+		}
+	}
+
+	// The package stays with its other versions, its post hook is not due yet
+	if len(bundle.GetPackageVersions(bundle.GetActiveBundle(), pkg)) > 0 {
+		fmt.Printf("✅ Package '%s:%s' deleted successfully from bundle [%s]\n", pkg, only, bundle.GetActiveBundle())
+		return
+	}
+	// Nor while other bundles or projects keep the package
+	if len(unused) < len(versions) || packageInUse(bundle, pkg) {
+		fmt.Printf("✅ Package '%s' deleted successfully from bundle [%s]\n", pkg, bundle.GetActiveBundle())
+		return
+	}
+
+	hooks, err := ma.LoadScriptHooksFromManifest(pkg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading script hooks: %v\n", err)
+		return
+	}
+
+	postHook := artifacts.NewShellHook(hooks.PostHook, pm.HostEnvVars)
+	if err := postHook.Execute(context.TODO()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error executing post-hook: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Package '%s' deleted successfully from bundle [%s]\n", pkg, bundle.GetActiveBundle())
+}
 
-		preHook := artifacts.NewShellHook(hooks.PostHook, pm.HostEnvVars)
-		if err := preHook.Execute(context.TODO()); err != nil {
-			fmt.Fprintf(os.Stderr, "Error executing post-hook: %v\n", err)
-			return
+// packageInUse reports whether any bundle still has a version of pkg.
+func packageInUse(bundle *environment.Bundle, pkg string) bool {
+	for _, name := range bundle.ListBundles() {
+		if len(bundle.GetPackageVersions(name, pkg)) > 0 {
+			return true
 		}
+	}
+	return false
+}
 
-		fmt.Printf("✅ Package '%s' deleted successfully from bundle [%s]\n", pkg, bundle.GetActiveBundle())
-	},
+// removeImage removes a no longer used image from the runtime. The package is
+// deleted already, so a failure is only reported.
+func removeImage(e *environment.Environment, reference string) {
+	rt, err := container.NewRuntime(e.Config.Runtime)
+	if err == nil {
+		err = rt.Remove(context.TODO(), reference)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove image %s: %v\n", reference, err)
+		return
+	}
+	fmt.Printf("🗑️  Removed image %s\n", reference)
 }
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcDryRunFlag bool
+	gcImagesFlag bool
+	gcKeepFlag   int
+)
+
+func init() {
+	GcCmd.Flags().BoolVar(&gcDryRunFlag, "dry-run", false, "Only list what would be removed")
+	GcCmd.Flags().BoolVar(&gcImagesFlag, "images", false, "Also remove the images please pulled for the removed versions")
+	GcCmd.Flags().IntVar(&gcKeepFlag, "keep", 0, "Keep the newest N unused versions of every package")
+}
+
+var GcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Removes package versions no bundle uses anymore",
+	Long: `Removes the installed package versions that are used neither by a bundle nor by
+a project, for instance after please delete bundle or please upgrade. Versions
+another please command is installing are kept. With
+--images, the images please pulled for the removed versions are removed from
+the runtime as well, other images are never touched.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if gcKeepFlag < 0 {
+			fmt.Fprintln(os.Stderr, "Error: --keep must not be negative")
+			os.Exit(1)
+		}
+
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		installed, err := e.InstalledArtifacts()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		unused, err := e.UnreferencedArtifacts(bundle, gcKeepFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The recorded image references are gone with the removed versions
+		images := make(map[environment.Artifact]string, len(installed))
+		for _, a := range installed {
+			images[a] = e.ArtifactImage(a)
+		}
+
+		var reclaimed int64
+		failed := 0
+		removed := make(map[environment.Artifact]bool)
+		for _, a := range unused {
+			size := e.ArtifactSize(a)
+			if !gcDryRunFlag {
+				if err := e.RemoveArtifact(a); err != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s: %v\n", a, err)
+					failed++
+					continue
+				}
+			}
+			removed[a] = true
+			reclaimed += size
+			fmt.Printf("🗑️  %s (%s)\n", a, formatSize(size))
+		}
+
+		if gcImagesFlag {
+			size, n, err := removeUnusedImages(e, installed, images, removed)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			reclaimed += size
+			failed += n
+		}
+
+		switch {
+		case gcDryRunFlag:
+			fmt.Printf("Would reclaim %s\n", formatSize(reclaimed))
+		case len(removed) == 0 && reclaimed == 0:
+			fmt.Println("✅ Nothing to remove")
+		default:
+			fmt.Printf("✅ Reclaimed %s\n", formatSize(reclaimed))
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// removeUnusedImages removes the images please pulled for the versions it
+// removed, unless a version that stays was pulled from the same reference.
+// It returns the reclaimed space and the number of images that could not be
+// removed.
+func removeUnusedImages(e *environment.Environment, installed []environment.Artifact, images map[environment.Artifact]string, removed map[environment.Artifact]bool) (int64, int, error) {
+	rt, err := container.NewRuntime(e.Config.Runtime)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	inUse := make(map[string]bool)
+	for _, a := range installed {
+		if !removed[a] && images[a] != "" {
+			inUse[images[a]] = true
+		}
+	}
+
+	var reclaimed int64
+	failed := 0
+	seen := make(map[string]bool)
+	for _, a := range installed {
+		reference := images[a]
+		if !removed[a] || reference == "" || inUse[reference] || seen[reference] {
+			continue
+		}
+		seen[reference] = true
+
+		// Removed from the runtime behind please's back
+		info, err := rt.Inspect(context.TODO(), reference)
+		if err != nil {
+			continue
+		}
+		if !gcDryRunFlag {
+			if err := rt.Remove(context.TODO(), reference); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", reference, err)
+				failed++
+				continue
+			}
+		}
+		reclaimed += info.Size
+		fmt.Printf("🗑️  %s (%s)\n", reference, formatSize(info.Size))
+	}
+	return reclaimed, failed, nil
+}
+
+// formatSize prints a byte count with a binary unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+const (
+	projectBinVar  = "PLEASE_PROJECT_BIN"
+	projectFileVar = "PLEASE_PROJECT"
+)
+
+const bashHook = `_please_hook() {
+  local previous_exit_status=$?
+  if [ "${_PLEASE_LAST_PWD:-}" != "$PWD" ]; then
+    _PLEASE_LAST_PWD="$PWD"
+    eval "$(%[1]s hook-env bash)"
+  fi
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND[*]:-};" != *";_please_hook;"* ]]; then
+  PROMPT_COMMAND="_please_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`
+
+const zshHook = `_please_hook() {
+  eval "$(%[1]s hook-env zsh)"
+}
+typeset -ag chpwd_functions
+if (( ! ${chpwd_functions[(I)_please_hook]} )); then
+  chpwd_functions=(_please_hook $chpwd_functions)
+fi
+_please_hook
+`
+
+const fishHook = `function _please_hook --on-variable PWD
+    %[1]s hook-env fish | source
+end
+_please_hook
+`
+
+var shellHooks = map[string]string{
+	"bash": bashHook,
+	"zsh":  zshHook,
+	"fish": fishHook,
+}
+
+var HookCmd = &cobra.Command{
+	Use:   "hook <bash|zsh|fish>",
+	Short: "Prints the shell hook for automatic per-project version switching",
+	Long: `Prints a shell snippet that activates the packages declared in the nearest
+` + environment.ProjectFileName + ` whenever the working directory changes.
+
+Add one of the following lines to your shell configuration:
+
+  bash: eval "$(please hook bash)"
+  zsh:  eval "$(please hook zsh)"
+  fish: please hook fish | source`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		hook, ok := shellHooks[args[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unsupported shell %q, use one of bash, zsh or fish\n", args[0])
+			os.Exit(1)
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			executable = "please"
+		}
+		quote := posixQuote
+		if args[0] == "fish" {
+			quote = fishQuote
+		}
+		fmt.Printf(hook, quote(executable))
+	},
+}
+
+var hookEnvCmd = &cobra.Command{
+	Use:    "hook-env <bash|zsh|fish>",
+	Short:  "Prints the environment changes for the current directory",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		shell := args[0]
+		if _, ok := shellHooks[shell]; !ok {
+			fmt.Fprintf(os.Stderr, "Unsupported shell %q\n", shell)
+			return
+		}
+
+		e := environment.New()
+		if !e.IsInitialized() {
+			return
+		}
+
+		path := removeFromPathList(os.Getenv("PATH"), os.Getenv(projectBinVar))
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return
+		}
+
+		projectFile, err := environment.FindProjectFile(cwd)
+		if errors.Is(err, environment.ErrNoProjectFile) {
+			if os.Getenv(projectBinVar) != "" {
+				fmt.Print(exportEnv(shell, "PATH", path))
+				fmt.Print(unsetEnv(shell, projectBinVar))
+				fmt.Print(unsetEnv(shell, projectFileVar))
+			}
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "please: %v\n", err)
+			return
+		}
+
+		project, err := environment.LoadProject(projectFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "please: %v\n", err)
+			return
+		}
+
+		binPath, missing, skipped, err := e.LinkProject(projectFile, project)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "please: %v\n", err)
+			return
+		}
+		for _, m := range missing {
+			fmt.Fprintf(os.Stderr, "please: %s from %s is not installed, run: please install %s\n", m, projectFile, m)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(os.Stderr, "please: %s from %s is not linked\n", s, projectFile)
+		}
+
+		fmt.Print(exportEnv(shell, "PATH", binPath+string(os.PathListSeparator)+path))
+		fmt.Print(exportEnv(shell, projectBinVar, binPath))
+		fmt.Print(exportEnv(shell, projectFileVar, projectFile))
+	},
+}
+
+func removeFromPathList(pathList, dir string) string {
+	if dir == "" {
+		return pathList
+	}
+
+	parts := filepath.SplitList(pathList)
+	kept := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != dir {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, string(os.PathListSeparator))
+}
+
+func exportEnv(shell, key, value string) string {
+	if shell == "fish" {
+		if key == "PATH" {
+			parts := filepath.SplitList(value)
+			quoted := make([]string, 0, len(parts))
+			for _, p := range parts {
+				quoted = append(quoted, fishQuote(p))
+			}
+			return fmt.Sprintf("set -gx PATH %s;\n", strings.Join(quoted, " "))
+		}
+		return fmt.Sprintf("set -gx %s %s;\n", key, fishQuote(value))
+	}
+	return fmt.Sprintf("export %s=%s;\n", key, posixQuote(value))
+}
+
+func unsetEnv(shell, key string) string {
+	if shell == "fish" {
+		return fmt.Sprintf("set -e %s;\n", key)
+	}
+	return fmt.Sprintf("unset %s;\n", key)
+}
+
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
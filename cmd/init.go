@@ -43,7 +43,11 @@ var InitCmd = &cobra.Command{
 			os.Exit(1)
 		}
 		fmt.Println("Updating cache...")
-		e.DownloadManifestFiles(manifestURLs)
+		results, _ := e.DownloadManifestFiles(manifestURLs)
+		printDownloadSummary(results)
+		if err := e.RebuildManifestIndexes(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error indexing manifests: %v\n", err)
+		}
 
 		fmt.Printf("Adding %s to $PATH\n", e.BinPath)
 		utils.AddToUserPath(e.BinPath)
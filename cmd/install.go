@@ -4,63 +4,92 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/arafat/please/artifacts"
+	"github.com/arafat/please/config"
 	"github.com/arafat/please/container"
 	"github.com/arafat/please/environment"
+	"github.com/arafat/please/schema"
 	"github.com/arafat/please/utils"
+	"github.com/arafat/please/utils/semver"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 )
 
+var (
+	frozenFlag      bool
+	installKeepFlag bool
+)
+
+func init() {
+	InstallCmd.Flags().BoolVar(&frozenFlag, "frozen", false, "Fail if an image digest no longer matches the one pinned in the bundle. Without a package, reinstalls the whole active bundle")
+	InstallCmd.Flags().BoolVar(&installKeepFlag, "keep", false, "Install next to the versions of the package the bundle has, linked as <executable>@<version>")
+}
+
 var InstallCmd = &cobra.Command{
-	Use:   "install [namespace:package:version]",
-	Short: "installs a containerized app, default namespace is 'core'.",
-	Long:  `installs a containerized app, default namespace is 'core'.`,
+	Use:   "install [namespace:]package[:version|@constraint]",
+	Short: "installs a containerized app from any configured namespace.",
+	Long: `installs a containerized app from any configured namespace.
+Without a namespace every manifest source is searched; if the package exists in
+more than one namespace, the namespace has to be given explicitly.
+
+A version is either a literal tag (kubectl:1.29.0) or a constraint resolved
+against the available versions: kubectl@^1.29, python@~3.11, jq@latest or
+node@lts. Without a version the picker is shown or the default version is
+installed, depending on the install.prompt setting.
+
+A different version replaces the one in the bundle. With --keep it is
+installed next to it instead, as python@3.12 for instance; please use switches
+which version the plain executable name runs.`,
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 {
+		if len(args) < 1 && !frozenFlag {
 			return fmt.Errorf("missing package name")
 		}
 		return nil
 	},
 	// TODO: This entire installation logic needs to be refactored into package appmanagement (installer, deinstaller)
 	Run: func(cmd *cobra.Command, args []string) {
-		packageName := args[0]
 		e := environment.New()
 		if !e.IsInitialized() {
 			fmt.Printf("Please has not been initialized yet. Run please init.")
 		}
 
+		if len(args) == 0 {
+			if err := installFrozenBundle(e); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		packageName := args[0]
 		namespace, pkg, version := parseIdentifier(packageName)
 
-		if namespace == "" {
-			namespace = "core"
+		resolver, err := environment.NewManifestResolver(e)
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
 
-		// TODO: when multiple namespaces are supported
-		// we need to do the according changes here since we
-		// need to search in a different manifest archive
-		ma := environment.NewManifestArchive(e.ManifestCoreFile)
-		pm, err := ma.ExactMatch(pkg)
-
+		ma, pm, err := resolver.Resolve(namespace, pkg)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
+		regClient := e.RegistryClient()
+		spec := version
 		if version == "" {
-			var versions []string
-			if pm.VersionDiscovery != nil {
-				regClient := container.NewRegistryClient()
-				versions, err = regClient.ListVersions(context.Background(), pm)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error fetching versions: %v\n", err)
-					return
-				}
-			} else {
-				versions = pm.Versions
+			if version, err = selectVersion(e, regClient, pm); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return
 			}
-			version, _ = utils.SelectFromOptions(versions, "Select a version")
+		} else if version, err = resolveVersion(regClient, pm, version); err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving version: %v\n", err)
+			os.Exit(1)
 		}
 
 		bundle, err := environment.LoadBundleDefinitions(e)
@@ -74,69 +103,365 @@ var InstallCmd = &cobra.Command{
 			return
 		}
 
-		client, err := container.NewClient()
+		pinned := bundle.GetPackageDigest(activeBundle, pkg, version)
+		digest, err := resolveDigest(context.TODO(), regClient, pm, version, pinned, frozenFlag)
 		if err != nil {
-			fmt.Println(err)
-			return
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
 
-		hooks, err := ma.LoadScriptHooksFromManifest(pkg)
+		op, err := e.BeginOperation("install", activeBundle)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading script hooks: %v\n", err)
-			return
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := op.Creates(pkg, version); err != nil {
+			abortOperation(op, err)
 		}
 
-		replacer := utils.MakeRuntimeReplacer(version)
-		replacer(pm.ContainerArgs.ContainerEnvVars)
-		replacer(pm.HostEnvVars)
+		if err := deployPackage(e, ma, pm, pkg, version, digest); err != nil {
+			abortOperation(op, err)
+		}
 
-		preHook := artifacts.NewShellHook(hooks.PreHook, pm.HostEnvVars)
-		if err := preHook.Execute(context.TODO()); err != nil {
-			fmt.Fprintf(os.Stderr, "Error executing pre-hook: %v\n", err)
-			return
+		addPackage := bundle.AddPackage
+		if installKeepFlag {
+			addPackage = bundle.AddPackageVersion
+		}
+		if err := addPackage(activeBundle, pkg, version); err != nil {
+			abortOperation(op, err)
+		}
+		bundle.SetPackageNamespace(activeBundle, pkg, version, ma.Namespace)
+		if digest != "" {
+			bundle.SetPackageDigest(activeBundle, pkg, version, digest)
 		}
+		if isVersionConstraint(spec) {
+			bundle.SetPackageConstraint(activeBundle, pkg, version, spec)
+		}
+		if err := op.Commit(bundle); err != nil {
+			abortOperation(op, fmt.Errorf("Error saving bundle: %w", err))
+		}
+		finishOperation(op)
+		relinkBundle(e, bundle)
 
-		platform := selectContainerPlatform(e.Arch, pm.Platforms)
-		err = client.Install(context.TODO(), pm.Image, version, platform)
-		if err != nil {
-			if err.Error() == "exit status 2" {
-				// NOOP - all good and expected error
-			} else {
-				fmt.Println(err)
-				return
-			}
+		fmt.Printf("✅ Successfully installed %s:%s in bundle [%s]\n", pkg, version, activeBundle)
+		if pm.Script == schema.ScriptService {
+			fmt.Printf("Run please service start %s to start it\n", pkg)
 		}
+	},
+}
+
+// ltsVersion selects the long-term support line declared by a manifest.
+const ltsVersion = "lts"
+
+// availableVersions lists the versions of a package, newest first, from the
+// registry if the manifest uses version discovery.
+func availableVersions(regClient *container.RegistryClient, pm *schema.PackageManifest) ([]string, error) {
+	if pm.VersionDiscovery != nil {
+		return regClient.ListVersions(context.Background(), pm)
+	}
+	return pm.Versions, nil
+}
+
+// selectVersion picks the version to install if none was given. Depending on
+// install.prompt the picker is shown, or the manifest's default version and
+// otherwise the latest stable one is installed.
+func selectVersion(e *environment.Environment, regClient *container.RegistryClient, pm *schema.PackageManifest) (string, error) {
+	versions, err := availableVersions(regClient, pm)
+	if err != nil {
+		return "", fmt.Errorf("Error fetching versions: %w", err)
+	}
+
+	prompt := e.Config.Install.Prompt
+	if prompt == config.PromptAlways || (prompt == config.PromptAuto && isatty.IsTerminal(os.Stdin.Fd())) {
+		version, _ := utils.SelectFromOptions(versions, "Select a version")
+		return version, nil
+	}
+	return defaultVersion(pm, versions)
+}
+
+// defaultVersion returns the manifest's default version, resolved against
+// versions if it is a constraint, or the latest stable version without one.
+func defaultVersion(pm *schema.PackageManifest, versions []string) (string, error) {
+	if pm.DefaultVersion != "" {
+		if !semver.IsConstraint(pm.DefaultVersion) {
+			return pm.DefaultVersion, nil
+		}
+		return matchVersion(pm, pm.DefaultVersion, versions)
+	}
+	return matchVersion(pm, semver.Latest, versions)
+}
+
+// isVersionConstraint reports whether spec follows newer versions rather than
+// pinning a tag.
+func isVersionConstraint(spec string) bool {
+	return spec == ltsVersion || semver.IsConstraint(spec)
+}
+
+// versionSpec maps "lts" to the constraint or tag the manifest declares for
+// its long-term support line and returns any other spec unchanged.
+func versionSpec(pm *schema.PackageManifest, spec string) (string, error) {
+	if spec != ltsVersion {
+		return spec, nil
+	}
+	switch {
+	case pm.LTS != "":
+		return pm.LTS, nil
+	case pm.DefaultVersion != "":
+		return pm.DefaultVersion, nil
+	}
+	return "", fmt.Errorf("package %q does not declare an lts version", pm.Name)
+}
+
+// resolveVersion turns a version spec into a concrete tag. Literal tags are
+// checked with validateTag and returned unchanged; constraints, "latest" and
+// "lts" are resolved against the available versions without prompting.
+func resolveVersion(regClient *container.RegistryClient, pm *schema.PackageManifest, spec string) (string, error) {
+	spec, err := versionSpec(pm, spec)
+	if err != nil {
+		return "", err
+	}
+	if !semver.IsConstraint(spec) {
+		if err := validateTag(pm, spec); err != nil {
+			return "", err
+		}
+		return spec, nil
+	}
+
+	versions, err := availableVersions(regClient, pm)
+	if err != nil {
+		return "", fmt.Errorf("Error fetching versions: %w", err)
+	}
+	return matchVersion(pm, spec, versions)
+}
+
+// validateTag checks a literal tag given on the command line. It becomes a
+// directory of the versions directory, so it has to be a valid version and,
+// if the manifest lists its versions, one of them.
+func validateTag(pm *schema.PackageManifest, tag string) error {
+	if err := environment.ValidateVersion(tag); err != nil {
+		return fmt.Errorf("package %q: %w", pm.Name, err)
+	}
+	if len(pm.Versions) > 0 && !slices.Contains(pm.Versions, tag) {
+		return fmt.Errorf("package %q: version %q is not available", pm.Name, tag)
+	}
+	return nil
+}
+
+// matchVersion returns the newest of versions satisfying the constraint.
+func matchVersion(pm *schema.PackageManifest, constraint string, versions []string) (string, error) {
+	version, err := semver.Resolve(constraint, versions)
+	if err != nil {
+		return "", fmt.Errorf("package %q: %w", pm.Name, err)
+	}
+	return version, nil
+}
 
-		bundle.AddPackage(activeBundle, pkg, version)
-		bundle.SaveBundle(e)
+// installFrozenBundle reinstalls every package of the active bundle from its
+// pinned digest and fails on the first package whose digest has changed.
+func installFrozenBundle(e *environment.Environment) error {
+	bundle, err := environment.LoadBundleDefinitions(e)
+	if err != nil {
+		return fmt.Errorf("Error loading bundle definitions: %w", err)
+	}
 
-		if pm.Script == "standard" {
-			stdScript := &artifacts.StandardScript{
-				ContainerArgs:   pm.ContainerArgs,
-				ApplicationArgs: pm.ApplicationArgs,
-				Image:           pm.Image,
-				Version:         version,
-				Application:     pkg,
-				Platform:        platform,
-				Executable:      pm.Exec,
-				HostEnvs:        pm.HostEnvVars,
+	resolver, err := environment.NewManifestResolver(e)
+	if err != nil {
+		return err
+	}
+
+	// One client for all packages, so that registry tokens are reused
+	regClient := e.RegistryClient()
+	activeBundle := bundle.GetActiveBundle()
+	packages := bundle.GetAllPackageVersions(activeBundle)
+	pkgs := make([]string, 0, len(packages))
+	for pkg := range packages {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		for _, version := range packages[pkg] {
+			ma, pm, err := resolver.ResolveInstalled(bundle, activeBundle, pkg, version)
+			if err != nil {
+				return fmt.Errorf("Error finding package %q: %w", pkg, err)
+			}
+
+			pinned := bundle.GetPackageDigest(activeBundle, pkg, version)
+			digest, err := resolveDigest(context.TODO(), regClient, pm, version, pinned, true)
+			if err != nil {
+				return err
 			}
 
-			var executable string
-			if pm.Exec != "" {
-				executable = pm.Exec
-			} else {
-				executable = pm.Name
+			if err := deployPackage(e, ma, pm, pkg, version, digest); err != nil {
+				return err
 			}
-			e.DeployArtifact(stdScript, pkg, executable, version)
-			e.CreateSymlink(pkg, executable, version)
+			fmt.Printf("✅ Installed %s:%s@%s\n", pkg, version, digest)
+		}
+	}
+	relinkBundle(e, bundle)
+
+	return nil
+}
+
+// resolveDigest looks up the digest the registry currently serves for the
+// package version and checks it against the pinned digest. In frozen mode a
+// missing pin, an unreachable registry or a changed digest is an error.
+func resolveDigest(ctx context.Context, regClient *container.RegistryClient, pm *schema.PackageManifest, version, pinned string, frozen bool) (string, error) {
+	digest, err := regClient.ResolveDigest(ctx, pm.Image, version)
+	if err != nil {
+		if frozen {
+			return "", fmt.Errorf("failed to verify digest of %s:%s: %w", pm.Name, version, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: could not pin %s:%s to a digest, the shim will use the tag: %v\n", pm.Name, version, err)
+		return pinned, nil
+	}
+
+	if frozen {
+		if pinned == "" {
+			return "", fmt.Errorf("%s:%s is not pinned, run please lock first", pm.Name, version)
+		}
+		if pinned != digest {
+			return "", fmt.Errorf("digest of %s:%s changed from %s to %s", pm.Name, version, pinned, digest)
+		}
+	} else if pinned != "" && pinned != digest {
+		fmt.Fprintf(os.Stderr, "Warning: digest of %s:%s changed from %s to %s\n", pm.Name, version, pinned, digest)
+	}
+
+	return digest, nil
+}
+
+// deployPackage runs the install hook, pulls the image and deploys the shim of
+// pkg:version, or the definition of a service package. It is linked by
+// relinkBundle once the bundle is saved.
+func deployPackage(e *environment.Environment, ma *environment.ManifestArchive, pm *schema.PackageManifest, pkg, version, digest string) error {
+	if pm.Script != schema.ScriptStandard && pm.Script != schema.ScriptService {
+		return fmt.Errorf("Script type [%s] is not supported.", pm.Script)
+	}
+
+	rt, err := container.NewRuntime(e.Config.Runtime)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := ma.LoadScriptHooksFromManifest(pkg)
+	if err != nil {
+		return fmt.Errorf("Error loading script hooks: %w", err)
+	}
+
+	replacer := utils.MakeRuntimeReplacer(version)
+	replacer(pm.ContainerArgs.ContainerEnvVars)
+	replacer(pm.HostEnvVars)
+
+	preHook := artifacts.NewShellHook(hooks.PreHook, pm.HostEnvVars)
+	if err := preHook.Execute(context.TODO()); err != nil {
+		return fmt.Errorf("Error executing pre-hook: %w", err)
+	}
+
+	platform := selectContainerPlatform(e.Arch, pm.Platforms)
+	reference := container.ImageReference(pm.Image, version, digest)
+	err = rt.Pull(context.TODO(), reference, platform)
+	if err != nil {
+		if err.Error() == "exit status 2" {
+			// NOOP - all good and expected error
 		} else {
-			fmt.Printf("Script type [%s] is not supported.", pm.Script)
-			return
+			return err
 		}
+	}
 
-		fmt.Printf("✅ Successfully installed %s:%s in bundle [%s]\n", pkg, version, activeBundle)
-	},
+	if pm.Script == schema.ScriptService {
+		if err := e.DeployService(newServiceDefinition(e, pm, version, digest, platform), pkg, version); err != nil {
+			return err
+		}
+		return e.RecordImage(pkg, version, reference)
+	}
+
+	stdScript := newStandardScript(e, rt, pm, pkg, version, digest, platform)
+
+	var executable string
+	if pm.Exec != "" {
+		executable = pm.Exec
+	} else {
+		executable = pm.Name
+	}
+	if _, err := e.DeployArtifact(stdScript, pkg, executable, version); err != nil {
+		return err
+	}
+	return e.RecordImage(pkg, version, reference)
+}
+
+// abortOperation rolls back op after err and exits.
+func abortOperation(op *environment.Operation, err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if err := op.Finish(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rolling back %s: %v\n", op.Name, err)
+	}
+	os.Exit(1)
+}
+
+// finishOperation completes a committed op. The change is saved already, a
+// failure only leaves obsolete files behind for the next command to remove.
+func finishOperation(op *environment.Operation) {
+	if err := op.Finish(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to complete %s: %v\n", op.Name, err)
+	}
+}
+
+// relinkBundle refreshes the bin directory of the active bundle after its
+// packages changed: that of the please shell or else the global one.
+func relinkBundle(e *environment.Environment, bundle *environment.Bundle) {
+	var skipped []string
+	var err error
+	if bundle.InSession() {
+		_, _, skipped, err = e.LinkBundle(bundle, bundle.GetActiveBundle())
+	} else {
+		_, skipped, err = e.ActivateBundle(bundle, bundle.GetActiveBundle())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to link bundle [%s]: %v\n", bundle.GetActiveBundle(), err)
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "Warning: %s from bundle [%s] is not linked\n", s, bundle.GetActiveBundle())
+	}
+}
+
+// newStandardScript describes the shim of pkg:version. The manifest's runtime
+// placeholders have to be replaced already.
+func newStandardScript(e *environment.Environment, rt container.Runtime, pm *schema.PackageManifest, pkg, version, digest, platform string) *artifacts.StandardScript {
+	// Flags from the shim configuration apply to every package
+	containerArgs := pm.ContainerArgs
+	containerArgs.AdditionalFlags = append(slices.Clone(containerArgs.AdditionalFlags), e.Config.Shim.ExtraFlags...)
+
+	return &artifacts.StandardScript{
+		ContainerArgs:   containerArgs,
+		Runtime:         rt,
+		ApplicationArgs: pm.ApplicationArgs,
+		Image:           pm.Image,
+		Version:         version,
+		Digest:          digest,
+		Application:     pkg,
+		Platform:        platform,
+		Executable:      pm.Exec,
+		HostEnvs:        pm.HostEnvVars,
+		PassEnv:         e.Config.Shim.PassEnv,
+	}
+}
+
+// newServiceDefinition describes the container of the service package
+// pm:version. The manifest's runtime placeholders have to be replaced already.
+func newServiceDefinition(e *environment.Environment, pm *schema.PackageManifest, version, digest, platform string) *artifacts.ServiceDefinition {
+	containerArgs := pm.ContainerArgs
+	containerArgs.AdditionalFlags = append(slices.Clone(containerArgs.AdditionalFlags), e.Config.Shim.ExtraFlags...)
+
+	return &artifacts.ServiceDefinition{
+		ContainerArgs:   containerArgs,
+		Service:         pm.Service,
+		ApplicationArgs: pm.ApplicationArgs,
+		Image:           pm.Image,
+		Version:         version,
+		Digest:          digest,
+		Platform:        platform,
+		Executable:      pm.Exec,
+	}
 }
 
 func selectContainerPlatform(local string, available []string) string {
@@ -152,6 +477,11 @@ func selectContainerPlatform(local string, available []string) string {
 }
 
 func parseIdentifier(s string) (namespace, pkg, version string) {
+	if name, spec, ok := strings.Cut(s, "@"); ok {
+		namespace, pkg = parsePackageName(name)
+		return namespace, pkg, spec
+	}
+
 	parts := strings.Split(s, ":")
 
 	switch len(parts) {
@@ -168,3 +498,11 @@ func parseIdentifier(s string) (namespace, pkg, version string) {
 
 	return
 }
+
+// parsePackageName splits an identifier without version, [namespace:]package.
+func parsePackageName(s string) (namespace, pkg string) {
+	if ns, name, ok := strings.Cut(s, ":"); ok {
+		return ns, name
+	}
+	return "", s
+}
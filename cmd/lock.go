@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+var lockUpdateFlag bool
+
+func init() {
+	LockCmd.Flags().BoolVar(&lockUpdateFlag, "update", false, "Re-pin packages whose digest has changed")
+}
+
+var LockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Pins the packages of the active bundle to their image digests",
+	Long: `Resolves the image digest of every package in the active bundle and records it in env.json.
+Already pinned packages are verified; a changed digest is an error unless --update is given.
+Run please install --frozen afterwards to deploy shims that use the pinned digests.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		resolver, err := environment.NewManifestResolver(e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		regClient := e.RegistryClient()
+		activeBundle := bundle.GetActiveBundle()
+		packages := bundle.GetAllPackageVersions(activeBundle)
+		pkgs := make([]string, 0, len(packages))
+		for pkg := range packages {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+
+		failed := 0
+		for _, pkg := range pkgs {
+			for _, version := range packages[pkg] {
+				_, pm, err := resolver.ResolveInstalled(bundle, activeBundle, pkg, version)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s:%s: %v\n", pkg, version, err)
+					failed++
+					continue
+				}
+
+				digest, err := regClient.ResolveDigest(context.TODO(), pm.Image, version)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s:%s: %v\n", pkg, version, err)
+					failed++
+					continue
+				}
+
+				pinned := bundle.GetPackageDigest(activeBundle, pkg, version)
+				switch {
+				case pinned == "":
+					bundle.SetPackageDigest(activeBundle, pkg, version, digest)
+					fmt.Printf("🔒 %s:%s pinned to %s\n", pkg, version, digest)
+				case pinned == digest:
+					fmt.Printf("✅ %s:%s matches %s\n", pkg, version, digest)
+				case lockUpdateFlag:
+					bundle.SetPackageDigest(activeBundle, pkg, version, digest)
+					fmt.Printf("🔒 %s:%s re-pinned from %s to %s\n", pkg, version, pinned, digest)
+				default:
+					fmt.Fprintf(os.Stderr, "❌ %s:%s digest changed from %s to %s\n", pkg, version, pinned, digest)
+					failed++
+				}
+			}
+		}
+
+		if err := bundle.SaveBundle(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving bundle: %v\n", err)
+			os.Exit(1)
+		}
+
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d package(s) in bundle [%s] could not be verified\n", failed, activeBundle)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/environment"
+	"github.com/arafat/please/schema"
+	"github.com/arafat/please/utils/semver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	outdatedBundleFlag string
+	outdatedAllFlag    bool
+)
+
+func init() {
+	OutdatedCmd.Flags().StringVar(&outdatedBundleFlag, "bundle", "", "Check the given bundle instead of the active one")
+	OutdatedCmd.Flags().BoolVar(&outdatedAllFlag, "all", false, "Check all bundles")
+}
+
+// packageUpdate describes the versions an installed package can move to.
+// Wanted is the newest version its constraint allows, Latest the newest
+// stable version available.
+type packageUpdate struct {
+	Bundle     string
+	Package    string
+	Current    string
+	Wanted     string
+	Latest     string
+	Constraint string
+}
+
+func (u *packageUpdate) outdated() bool {
+	return semver.Compare(u.Wanted, u.Current) > 0 || semver.Compare(u.Latest, u.Current) > 0
+}
+
+var OutdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "Lists installed packages with newer versions",
+	Long: `Compares the installed packages with the versions available in the registry or manifest.
+Wanted is the newest version the constraint the package was installed with allows;
+packages installed with an exact tag are pinned and stay at their version.
+Run please upgrade to move packages to their wanted version.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		var bundles []string
+		switch {
+		case outdatedAllFlag:
+			bundles = bundle.ListBundles()
+			sort.Strings(bundles)
+		case outdatedBundleFlag != "":
+			if !bundle.BundleExists(outdatedBundleFlag) {
+				fmt.Fprintf(os.Stderr, "Error: bundle %q does not exist\n", outdatedBundleFlag)
+				os.Exit(1)
+			}
+			bundles = []string{outdatedBundleFlag}
+		default:
+			bundles = []string{bundle.GetActiveBundle()}
+		}
+
+		resolver, err := environment.NewManifestResolver(e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		regClient := e.RegistryClient()
+		var updates []*packageUpdate
+		failed := 0
+		for _, bundleName := range bundles {
+			packages := bundle.GetInstalledPackages(bundleName)
+			for _, pkg := range sortedPackages(packages) {
+				_, pm, err := resolver.ResolveInstalled(bundle, bundleName, pkg, packages[pkg])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s:%s: %v\n", pkg, packages[pkg], err)
+					failed++
+					continue
+				}
+
+				update, err := checkUpdate(regClient, bundle, bundleName, pm, pkg, "")
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s:%s: %v\n", pkg, packages[pkg], err)
+					failed++
+					continue
+				}
+				if update.outdated() {
+					updates = append(updates, update)
+				}
+			}
+		}
+
+		if len(updates) == 0 {
+			fmt.Println("All packages are up to date.")
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "BUNDLE\tPACKAGE\tCURRENT\tWANTED\tLATEST\tCONSTRAINT")
+			for _, u := range updates {
+				constraint := u.Constraint
+				if constraint == "" {
+					constraint = "pinned"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.Bundle, u.Package, u.Current, u.Wanted, u.Latest, constraint)
+			}
+			w.Flush()
+		}
+
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// checkUpdate looks up the wanted and latest versions of pkg in bundleName.
+// The constraint recorded at install time applies unless spec overrides it;
+// without either the package is pinned to its current version.
+func checkUpdate(regClient *container.RegistryClient, bundle *environment.Bundle, bundleName string, pm *schema.PackageManifest, pkg, spec string) (*packageUpdate, error) {
+	current := bundle.GetInstalledPackages(bundleName)[pkg]
+	if spec == "" {
+		spec = bundle.GetPackageConstraint(bundleName, pkg, current)
+	}
+
+	update := &packageUpdate{
+		Bundle:     bundleName,
+		Package:    pkg,
+		Current:    current,
+		Wanted:     current,
+		Latest:     current,
+		Constraint: spec,
+	}
+
+	versions, err := availableVersions(regClient, pm)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching versions: %w", err)
+	}
+	if latest, err := semver.Resolve(semver.Latest, versions); err == nil {
+		update.Latest = latest
+	}
+
+	if spec == "" {
+		return update, nil
+	}
+	wanted, err := versionSpec(pm, spec)
+	if err != nil {
+		return nil, err
+	}
+	if semver.IsConstraint(wanted) {
+		if wanted, err = matchVersion(pm, wanted, versions); err != nil {
+			return nil, err
+		}
+	} else if err := validateTag(pm, wanted); err != nil {
+		return nil, err
+	}
+	update.Wanted = wanted
+
+	return update, nil
+}
+
+func sortedPackages(packages map[string]string) []string {
+	pkgs := make([]string, 0, len(packages))
+	for pkg := range packages {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
@@ -26,11 +26,21 @@ var RootCmd = &cobra.Command{
 	Install tools from curated container images and switch between versions
 	seamlessly without affecting your system installation.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		if cmd.Name() == "init" {
+		switch cmd.Name() {
+		case "init", "hook", "hook-env":
+			return nil
+		}
+		if cmd.Parent() == ConfigCmd {
 			return nil
 		}
 		s := environment.New()
+		if s.ConfigErr != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", s.ConfigErr)
+			fmt.Fprintln(os.Stderr, "Fix it with please config set or edit", s.ConfigPath())
+			os.Exit(1)
+		}
 		if s.IsInitialized() {
+			recoverOperations(s)
 			return nil
 		}
 
@@ -57,4 +67,36 @@ func init() {
 	RootCmd.AddCommand(SearchCmd)
 	RootCmd.AddCommand(InstallCmd)
 	RootCmd.AddCommand(InitCmd)
+	RootCmd.AddCommand(HookCmd)
+	RootCmd.AddCommand(hookEnvCmd)
+	RootCmd.AddCommand(LockCmd)
+	RootCmd.AddCommand(SourceCmd)
+	RootCmd.AddCommand(VersionsCmd)
+	RootCmd.AddCommand(OutdatedCmd)
+	RootCmd.AddCommand(UpgradeCmd)
+	RootCmd.AddCommand(ConfigCmd)
+	RootCmd.AddCommand(RunCmd)
+	RootCmd.AddCommand(ShellCmd)
+	RootCmd.AddCommand(GcCmd)
+	RootCmd.AddCommand(BundleCmd)
+	RootCmd.AddCommand(UseCmd)
+	RootCmd.AddCommand(ServiceCmd)
+}
+
+// recoverOperations completes the operations of interrupted commands before
+// the next command looks at the bundles.
+func recoverOperations(e *environment.Environment) {
+	ops, err := e.Recover()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to recover an interrupted operation: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Its journal is kept in", e.JournalPath())
+		return
+	}
+	for _, op := range ops {
+		if op.Committed {
+			fmt.Fprintf(os.Stderr, "🔧 Completed interrupted %s in bundle [%s]\n", op.Name, op.Bundle)
+		} else {
+			fmt.Fprintf(os.Stderr, "🔧 Rolled back interrupted %s in bundle [%s]\n", op.Name, op.Bundle)
+		}
+	}
 }
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/environment"
+	"github.com/arafat/please/schema"
+	"github.com/arafat/please/utils"
+	"github.com/spf13/cobra"
+)
+
+var RunCmd = &cobra.Command{
+	Use:   "run [namespace:]package[:version|@constraint] -- [args...]",
+	Short: "Runs a package once without installing it",
+	Long: `Runs a package once without installing it. The container is started exactly as
+its shim would start it, with stdin, stdout and stderr attached, and the exit
+code of the package is returned. No shim is deployed and env.json is left
+untouched. Without a version the manifest's default or the latest version runs.
+
+  please run jq:1.7 -- --version
+  please run terraform@~1.5 -- plan`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		code, err := runPackage(e, args[0], args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(code)
+	},
+}
+
+// runPackage runs identifier with args through a temporary shim and returns
+// its exit code.
+func runPackage(e *environment.Environment, identifier string, args []string) (int, error) {
+	namespace, pkg, version := parseIdentifier(identifier)
+
+	resolver, err := environment.NewManifestResolver(e)
+	if err != nil {
+		return 0, err
+	}
+
+	_, pm, err := resolver.Resolve(namespace, pkg)
+	if err != nil {
+		return 0, err
+	}
+	if pm.Script == schema.ScriptService {
+		return 0, fmt.Errorf("%s is a service, install it and run please service start %s", pkg, pkg)
+	}
+	if pm.Script != schema.ScriptStandard {
+		return 0, fmt.Errorf("Script type [%s] is not supported.", pm.Script)
+	}
+
+	regClient := e.RegistryClient()
+	if version == "" {
+		versions, err := availableVersions(regClient, pm)
+		if err != nil {
+			return 0, fmt.Errorf("Error fetching versions: %w", err)
+		}
+		if version, err = defaultVersion(pm, versions); err != nil {
+			return 0, err
+		}
+	} else if version, err = resolveVersion(regClient, pm, version); err != nil {
+		return 0, err
+	}
+
+	rt, err := container.NewRuntime(e.Config.Runtime)
+	if err != nil {
+		return 0, err
+	}
+
+	replacer := utils.MakeRuntimeReplacer(version)
+	replacer(pm.ContainerArgs.ContainerEnvVars)
+	replacer(pm.HostEnvVars)
+
+	platform := selectContainerPlatform(e.Arch, pm.Platforms)
+	reference := container.ImageReference(pm.Image, version, "")
+	if _, err := rt.Inspect(context.TODO(), reference); err != nil {
+		if err := rt.Pull(context.TODO(), reference, platform); err != nil {
+			return 0, fmt.Errorf("failed to pull %s: %w", reference, err)
+		}
+	}
+
+	// Render the shim to a temporary file so the invocation, including the
+	// shell expansions in its arguments, is exactly the installed one
+	shim, err := os.CreateTemp("", "please-run-*.sh")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary shim: %w", err)
+	}
+	shimPath := shim.Name()
+	shim.Close()
+	defer os.Remove(shimPath)
+
+	stdScript := newStandardScript(e, rt, pm, pkg, version, "", platform)
+	if err := stdScript.Deploy(shimPath); err != nil {
+		return 0, fmt.Errorf("failed to deploy script: %w", err)
+	}
+
+	run := exec.Command("bash", append([]string{shimPath}, args...)...)
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+
+	// Ctrl-C reaches the whole foreground process group, so the package
+	// handles it itself while please stays alive to remove the shim. A
+	// SIGTERM sent to please alone is passed on.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := run.Start(); err != nil {
+		return 0, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGTERM {
+					run.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := run.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitCode(exitErr), nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// exitCode returns the exit code of a failed package, 128+n like a shell if
+// it was killed by signal n.
+func exitCode(exitErr *exec.ExitError) int {
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if code := exitErr.ExitCode(); code > 0 {
+		return code
+	}
+	return 1
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arafat/please/artifacts"
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/environment"
+	"github.com/arafat/please/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceBundleFlag string
+	serviceFollowFlag bool
+	serviceTailFlag   int
+)
+
+func init() {
+	ServiceCmd.PersistentFlags().StringVarP(&serviceBundleFlag, "bundle", "b", "", "Bundle of the service instead of the active one")
+	serviceLogsCmd.Flags().BoolVarP(&serviceFollowFlag, "follow", "f", false, "Keep printing new output")
+	serviceLogsCmd.Flags().IntVar(&serviceTailFlag, "tail", 0, "Only print the last N lines")
+
+	ServiceCmd.AddCommand(serviceStartCmd)
+	ServiceCmd.AddCommand(serviceStopCmd)
+	ServiceCmd.AddCommand(serviceRestartCmd)
+	ServiceCmd.AddCommand(serviceStatusCmd)
+	ServiceCmd.AddCommand(serviceLogsCmd)
+	ServiceCmd.AddCommand(serviceListCmd)
+}
+
+var ServiceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Runs service packages such as databases in the background",
+	Long: `Runs service packages, e.g. postgres or redis, as detached containers. A
+service is installed into a bundle like any other package and runs once per
+bundle, with the version and named volumes of that bundle.
+
+  please install postgres:16
+  please service start postgres
+  please service logs postgres -f`,
+}
+
+var serviceStartCmd = &cobra.Command{
+	Use:   "start <pkg>",
+	Short: "Starts a service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadServiceEnv()
+		if err := s.start(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+	},
+}
+
+var serviceStopCmd = &cobra.Command{
+	Use:   "stop <pkg>",
+	Short: "Stops a service, its volumes are kept",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadServiceEnv()
+		if err := s.stop(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error stopping %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+	},
+}
+
+var serviceRestartCmd = &cobra.Command{
+	Use:   "restart <pkg>",
+	Short: "Restarts a service, with the version the bundle has now",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadServiceEnv()
+		if err := s.stop(args[0]); err != nil && !errors.Is(err, errServiceNotRunning) {
+			fmt.Fprintf(os.Stderr, "Error stopping %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		if err := s.start(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+	},
+}
+
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status [pkg]",
+	Short: "Shows the state of the services of the bundle",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadServiceEnv()
+
+		services := s.services.List(s.bundleName)
+		if len(args) == 1 {
+			svc := s.services.Get(s.bundleName, args[0])
+			if svc == nil {
+				fmt.Printf("%s has not been started in bundle [%s]\n", args[0], s.bundleName)
+				return
+			}
+			services = []*schema.Service{svc}
+		}
+		if len(services) == 0 {
+			fmt.Printf("No services started in bundle [%s]\n", s.bundleName)
+			return
+		}
+		s.print(services, false)
+	},
+}
+
+var serviceLogsCmd = &cobra.Command{
+	Use:   "logs <pkg>",
+	Short: "Prints the output of a service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadServiceEnv()
+
+		name, err := environment.ServiceContainerName(s.bundleName, args[0])
+		if err == nil {
+			err = s.rt.Logs(context.TODO(), name, serviceFollowFlag, serviceTailFlag)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var serviceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the services of every bundle",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadServiceEnv()
+
+		services := s.services.List("")
+		if len(services) == 0 {
+			fmt.Println("No services started")
+			return
+		}
+		s.print(services, true)
+	},
+}
+
+var errServiceNotRunning = errors.New("service is not running")
+
+// serviceEnv is what the service subcommands work on: the bundle, the
+// runtime running the containers, and the record of the started services.
+type serviceEnv struct {
+	e          *environment.Environment
+	bundle     *environment.Bundle
+	bundleName string
+	rt         container.Runtime
+	services   *environment.Services
+}
+
+// loadServiceEnv loads the service environment of the selected bundle,
+// exiting on failure.
+func loadServiceEnv() *serviceEnv {
+	e := environment.New()
+
+	bundle, err := environment.LoadBundleDefinitions(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+		os.Exit(1)
+	}
+	bundleName := serviceBundleFlag
+	if bundleName == "" {
+		bundleName = bundle.GetActiveBundle()
+	} else if !bundle.BundleExists(bundleName) {
+		fmt.Fprintf(os.Stderr, "Error: bundle %q does not exist\n", bundleName)
+		os.Exit(1)
+	}
+
+	rt, err := container.NewRuntime(e.Config.Runtime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	services, err := environment.LoadServices(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return &serviceEnv{e: e, bundle: bundle, bundleName: bundleName, rt: rt, services: services}
+}
+
+// start runs the container of the service pkg with the version the bundle
+// has and records it.
+func (s *serviceEnv) start(pkg string) error {
+	versions := s.bundle.GetPackageVersions(s.bundleName, pkg)
+	if len(versions) == 0 {
+		return fmt.Errorf("package %q is not installed in bundle [%s]", pkg, s.bundleName)
+	}
+	version := versions[0]
+	if !s.e.IsService(pkg, version) {
+		return fmt.Errorf("%s:%s is not a service package", pkg, version)
+	}
+	def, err := artifacts.LoadServiceDefinition(s.e.ServiceDefinitionPath(pkg, version))
+	if err != nil {
+		return err
+	}
+
+	name, err := environment.ServiceContainerName(s.bundleName, pkg)
+	if err != nil {
+		return err
+	}
+	status, err := s.rt.Status(context.TODO(), name)
+	switch {
+	case err == nil && status.Running():
+		return fmt.Errorf("%s is already running in bundle [%s]", pkg, s.bundleName)
+	case err == nil:
+		// An exited container holds on to the name
+		if err := s.rt.Stop(context.TODO(), name); err != nil && !errors.Is(err, container.ErrNoSuchContainer) {
+			return err
+		}
+	case !errors.Is(err, container.ErrNoSuchContainer):
+		return err
+	}
+
+	service := def.Service
+	service.Volumes = make([]string, len(def.Service.Volumes))
+	for i, volume := range def.Service.Volumes {
+		if service.Volumes[i], err = environment.ServiceVolume(s.bundleName, pkg, volume); err != nil {
+			return err
+		}
+	}
+	opts := container.ServiceOptions{
+		ContainerArgs: def.ContainerArgs,
+		Service:       service,
+		Name:          name,
+		Labels: map[string]string{
+			"please.bundle":  s.bundleName,
+			"please.package": pkg,
+			"please.version": version,
+		},
+		Reference:       def.Reference(),
+		Platform:        def.Platform,
+		Executable:      def.Executable,
+		ApplicationArgs: def.ApplicationArgs,
+	}
+	if err := s.rt.Start(context.TODO(), opts); err != nil {
+		return err
+	}
+
+	s.services.Put(&schema.Service{
+		Bundle:    s.bundleName,
+		Package:   pkg,
+		Version:   version,
+		Container: name,
+		Image:     def.Reference(),
+		Ports:     def.Service.Ports,
+		Started:   time.Now(),
+	})
+	if err := s.services.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Started %s:%s in bundle [%s]\n", pkg, version, s.bundleName)
+	for _, port := range def.Service.Ports {
+		fmt.Printf("   listening on %s\n", port)
+	}
+	return nil
+}
+
+// stop stops and removes the container of the service pkg. A record of a
+// container removed behind please's back is dropped.
+func (s *serviceEnv) stop(pkg string) error {
+	name, err := environment.ServiceContainerName(s.bundleName, pkg)
+	if err != nil {
+		return err
+	}
+	err = s.rt.Stop(context.TODO(), name)
+	if errors.Is(err, container.ErrNoSuchContainer) {
+		if s.services.Get(s.bundleName, pkg) == nil {
+			return fmt.Errorf("%w in bundle [%s]", errServiceNotRunning, s.bundleName)
+		}
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.services.Remove(s.bundleName, pkg)
+	if err := s.services.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Stopped %s in bundle [%s]\n", pkg, s.bundleName)
+	return nil
+}
+
+// checkServicesStopped fails while services of bundleName, or only its
+// service pkg unless pkg is empty, are recorded as started: their containers
+// are named after the bundle and run from its installed files.
+func checkServicesStopped(e *environment.Environment, bundleName, pkg string) error {
+	services, err := environment.LoadServices(e)
+	if err != nil {
+		return err
+	}
+	var running []string
+	for _, svc := range services.List(bundleName) {
+		if pkg == "" || svc.Package == pkg {
+			running = append(running, svc.Package)
+		}
+	}
+	if len(running) > 0 {
+		return fmt.Errorf("service %s still running in bundle [%s], run please service stop -b %s first", strings.Join(running, ", "), bundleName, bundleName)
+	}
+	return nil
+}
+
+// serviceVolumes returns the names of the volumes the service packages of
+// bundleName keep. They are named after the bundle, so they stay behind under
+// the old name if the bundle is renamed.
+func serviceVolumes(e *environment.Environment, bundle *environment.Bundle, bundleName string) ([]string, error) {
+	var volumes []string
+	for pkg, versions := range bundle.GetAllPackageVersions(bundleName) {
+		for _, version := range versions {
+			if !e.IsService(pkg, version) {
+				continue
+			}
+			def, err := artifacts.LoadServiceDefinition(e.ServiceDefinitionPath(pkg, version))
+			if err != nil {
+				return nil, err
+			}
+			for _, volume := range def.Service.Volumes {
+				name, err := environment.ServiceVolume(bundleName, pkg, volume)
+				if err != nil {
+					return nil, err
+				}
+				name, _, _ = strings.Cut(name, ":")
+				if !slices.Contains(volumes, name) {
+					volumes = append(volumes, name)
+				}
+			}
+		}
+	}
+	sort.Strings(volumes)
+	return volumes, nil
+}
+
+// print lists services with the state their containers are in now.
+func (s *serviceEnv) print(services []*schema.Service, withBundle bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if withBundle {
+		fmt.Fprint(w, "BUNDLE\t")
+	}
+	fmt.Fprintln(w, "SERVICE\tVERSION\tSTATE\tPORTS")
+	for _, svc := range services {
+		state := "removed"
+		if status, err := s.rt.Status(context.TODO(), svc.Container); err == nil {
+			state = status.State
+			if status.Health != "" {
+				state += " (" + status.Health + ")"
+			}
+		} else if !errors.Is(err, container.ErrNoSuchContainer) {
+			state = "unknown"
+		}
+
+		if withBundle {
+			fmt.Fprintf(w, "%s\t", svc.Bundle)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", svc.Package, svc.Version, state, strings.Join(svc.Ports, ", "))
+	}
+	w.Flush()
+}
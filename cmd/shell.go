@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+var ShellCmd = &cobra.Command{
+	Use:   "shell <bundle>",
+	Short: "Starts a shell using a bundle",
+	Long: `Starts your $SHELL with the packages of the bundle on PATH, without changing the
+globally active bundle. Other terminals and running scripts keep using theirs.
+Inside the shell $PLEASE_BUNDLE names the bundle and install, delete and
+upgrade operate on it. Exit the shell to leave the bundle.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		bundleName := args[0]
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		binPath, missing, skipped, err := e.LinkBundle(bundle, bundleName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, m := range missing {
+			fmt.Fprintf(os.Stderr, "please: %s from bundle [%s] is not installed\n", m, bundleName)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(os.Stderr, "please: %s from bundle [%s] is not linked\n", s, bundleName)
+		}
+
+		// Drop the global bin directory and that of an enclosing please shell
+		path := removeFromPathList(os.Getenv("PATH"), e.BinPath)
+		if previous := os.Getenv(environment.SessionBundleEnv); previous != "" {
+			path = removeFromPathList(path, e.BundleBinPath(previous))
+		}
+		path = binPath + string(os.PathListSeparator) + path
+
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+
+		session := exec.Command(shell)
+		session.Env = setEnv(os.Environ(), "PATH", path)
+		session.Env = setEnv(session.Env, environment.SessionBundleEnv, bundleName)
+		session.Stdin = os.Stdin
+		session.Stdout = os.Stdout
+		session.Stderr = os.Stderr
+
+		fmt.Printf("🐚 Entering bundle [%s], exit the shell to leave it\n", bundleName)
+		err = session.Run()
+		fmt.Printf("👋 Left bundle [%s]\n", bundleName)
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting %s: %v\n", shell, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// setEnv returns env with key set to value, replacing an existing entry.
+func setEnv(env []string, key, value string) []string {
+	result := make([]string, 0, len(env)+1)
+	for _, entry := range env {
+		if !strings.HasPrefix(entry, key+"=") {
+			result = append(result, entry)
+		}
+	}
+	return append(result, key+"="+value)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"text/tabwriter"
@@ -10,7 +11,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var showResolvedFlag bool
+
 func init() {
+	showBundleCmd.Flags().BoolVar(&showResolvedFlag, "resolved", false, "Include inherited packages and show which bundle each one comes from")
+
 	ShowCmd.AddCommand(showBundleCmd)
 	ShowCmd.AddCommand(showPackageCmd)
 }
@@ -24,7 +29,7 @@ var ShowCmd = &cobra.Command{
 var showBundleCmd = &cobra.Command{
 	Use:   "bundle <bundlename>",
 	Short: "Show information about bundles",
-	Long:  "Show all bundles or details about a specific bundle",
+	Long:  "Show all bundles with their descriptions, * marking the active one, or the packages of a specific bundle",
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		env := environment.New()
@@ -42,14 +47,47 @@ var showBundleCmd = &cobra.Command{
 		if len(args) == 0 {
 			bundles := bDefs.ListBundles()
 			fmt.Printf("%d available bundle(s): \n", len(bundles))
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 			for _, bundle := range bundles {
-				fmt.Printf("- %s\n", bundle)
+				marker := "-"
+				if bundle == bDefs.GetActiveBundle() {
+					marker = "*"
+				}
+				fmt.Fprintf(w, "%s %s\t%s\n", marker, bundle, bDefs.GetDescription(bundle))
 			}
+			w.Flush()
 		} else {
 			bundleName := args[0]
+			if !bDefs.BundleExists(bundleName) {
+				fmt.Printf("Bundle %q does not exist\n", bundleName)
+				return
+			}
+			if description := bDefs.GetDescription(bundleName); description != "" {
+				fmt.Println(description)
+			}
+			if extends := bDefs.GetExtends(bundleName); len(extends) > 0 {
+				fmt.Printf("Extends: %s\n", strings.Join(extends, ", "))
+			}
+
+			resolved := bDefs.ResolvePackages(bundleName)
 			packages := bDefs.GetInstalledPackages(bundleName)
+			if !showResolvedFlag {
+				for pkg, r := range resolved {
+					if r.Bundle != bundleName {
+						delete(packages, pkg)
+					}
+				}
+			}
 			fmt.Printf("%d installed package(s) in bundle [%s]\n", len(packages), bundleName)
-			for pkg, version := range packages {
+			for _, pkg := range sortedPackages(packages) {
+				version := packages[pkg]
+				if others := bDefs.GetPackageVersions(bundleName, pkg)[1:]; len(others) > 0 {
+					version += " (also " + strings.Join(others, ", ") + ")"
+				}
+				if origin := resolved[pkg].Bundle; origin != bundleName {
+					fmt.Printf("- %s, Version: %s (from %s)\n", pkg, version, origin)
+					continue
+				}
 				fmt.Printf("- %s, Version: %s\n", pkg, version)
 			}
 		}
@@ -58,7 +96,7 @@ var showBundleCmd = &cobra.Command{
 
 // Subcommand for showing packages
 var showPackageCmd = &cobra.Command{
-	Use:   "package <packagename>",
+	Use:   "package [namespace:]<packagename>",
 	Short: "Show information about a specific package",
 	Args:  cobra.ExactArgs(1), // Require exactly one argument
 	Run: func(cmd *cobra.Command, args []string) {
@@ -68,17 +106,22 @@ var showPackageCmd = &cobra.Command{
 			return
 		}
 
-		pkg := args[0]
+		namespace, pkg := parsePackageName(args[0])
 
 		fmt.Printf("Package information: %s\n", pkg)
-		ma := environment.NewManifestArchive(env.ManifestCoreFile)
-		pm, err := ma.ExactMatch(pkg)
+		resolver, err := environment.NewManifestResolver(env)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		ma, pm, err := resolver.Resolve(namespace, pkg)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error finding package:%v", err)
 			return
 		}
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		fmt.Fprintf(w, "Name:\t%s\n", pm.Name)
+		fmt.Fprintf(w, "Namespace:\t%s\n", ma.Namespace)
 		fmt.Fprintf(w, "Description:\t%s\n", pm.Description)
 		fmt.Fprintf(w, "Homepage:\t%s\n", pm.Homepage)
 		fmt.Fprintf(w, "License:\t%s\n", pm.License)
@@ -92,6 +135,41 @@ var showPackageCmd = &cobra.Command{
 		}
 		fmt.Fprintf(w, "Platforms:\t%s\n", strings.Join(pm.Platforms, ", "))
 
+		if err := printPackageUsage(w, env, pm.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+
 		w.Flush()
 	},
 }
+
+// printPackageUsage lists the installed versions of pkg together with the
+// bundles and projects using each of them.
+func printPackageUsage(w io.Writer, env *environment.Environment, pkg string) error {
+	bDefs, err := environment.LoadBundleDefinitions(env)
+	if err != nil {
+		return fmt.Errorf("Error loading bundle definitions: %w", err)
+	}
+	installed, err := env.InstalledArtifacts()
+	if err != nil {
+		return err
+	}
+
+	label := "Installed:"
+	for _, a := range installed {
+		if a.Package != pkg {
+			continue
+		}
+		references, err := env.ArtifactReferences(bDefs, a)
+		if err != nil {
+			return err
+		}
+		usage := "unused, removed by please gc"
+		if len(references) > 0 {
+			usage = "used by " + strings.Join(references, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s (%s)\n", label, a.Version, usage)
+		label = ""
+	}
+	return nil
+}
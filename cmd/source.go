@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+var sourceFlag string
+
+func init() {
+	SourceCmd.AddCommand(sourceTrustCmd)
+	SourceCmd.AddCommand(sourceUntrustCmd)
+	SourceCmd.AddCommand(sourceListCmd)
+
+	sourceTrustCmd.Flags().StringVar(&sourceFlag, "source", environment.AllSources, "Source URL the key is trusted for (default: all sources)")
+	sourceUntrustCmd.Flags().StringVar(&sourceFlag, "source", environment.AllSources, "Source URL the key was trusted for (default: all sources)")
+}
+
+var SourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Manage manifest sources and their signing keys",
+	Long: `Manage manifest sources and their signing keys.
+Once a key is trusted for a source, please update only accepts archives of that
+source that carry a valid, unexpired signature by one of its keys.`,
+}
+
+var sourceTrustCmd = &cobra.Command{
+	Use:   "trust <key>",
+	Short: "Trust a base64 encoded ed25519 public key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+		ts, err := environment.LoadTrustStore(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading trust store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := ts.Trust(sourceFlag, args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error trusting key: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := ts.Save(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving trust store: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ Key trusted for %s\n", describeSource(sourceFlag))
+	},
+}
+
+var sourceUntrustCmd = &cobra.Command{
+	Use:   "untrust <key>",
+	Short: "Remove a trusted key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+		ts, err := environment.LoadTrustStore(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading trust store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := ts.Untrust(sourceFlag, args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing key: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := ts.Save(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving trust store: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ Key removed for %s\n", describeSource(sourceFlag))
+	},
+}
+
+var sourceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sources and their trusted keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+		sources, err := e.LoadSources()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading sources: %v\n", err)
+			os.Exit(1)
+		}
+
+		ts, err := environment.LoadTrustStore(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading trust store: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, key := range ts.Keys[environment.AllSources] {
+			fmt.Printf("* all sources: %s\n", key)
+		}
+		for _, source := range sources {
+			keys := ts.Keys[source]
+			if len(keys) == 0 && len(ts.Keys[environment.AllSources]) == 0 {
+				fmt.Printf("- %s (unsigned)\n", source)
+				continue
+			}
+			fmt.Printf("- %s\n", source)
+			for _, key := range keys {
+				fmt.Printf("    %s\n", key)
+			}
+		}
+	},
+}
+
+func describeSource(source string) string {
+	if source == environment.AllSources {
+		return "all sources"
+	}
+	return source
+}
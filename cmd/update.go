@@ -20,6 +20,32 @@ var UpdateCmd = &cobra.Command{
 			os.Exit(1)
 		}
 		fmt.Println("Updating cache...")
-		s.DownloadManifestFiles(manifestURLs)
+		results, downloadErr := s.DownloadManifestFiles(manifestURLs)
+		printDownloadSummary(results)
+
+		fmt.Println("Indexing manifests...")
+		if err := s.RebuildManifestIndexes(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error indexing manifests: %v\n", err)
+			os.Exit(1)
+		}
+
+		if downloadErr != nil {
+			os.Exit(1)
+		}
 	},
 }
+
+func printDownloadSummary(results []environment.DownloadResult) {
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(os.Stderr, "❌ %s: %v (keeping previous manifest)\n", r.URL, r.Err)
+		case r.NotModified:
+			fmt.Printf("✅ %s: up to date\n", r.URL)
+		case r.Verified:
+			fmt.Printf("✅ %s: updated, signature verified\n", r.URL)
+		default:
+			fmt.Printf("✅ %s: updated (unsigned, see please source trust)\n", r.URL)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arafat/please/container"
+	"github.com/arafat/please/environment"
+	"github.com/arafat/please/schema"
+	"github.com/arafat/please/utils/semver"
+	"github.com/spf13/cobra"
+)
+
+var upgradeRemoveOldFlag bool
+
+func init() {
+	UpgradeCmd.Flags().BoolVar(&upgradeRemoveOldFlag, "remove-old", false, "Remove the previous version if no other bundle uses it")
+}
+
+var UpgradeCmd = &cobra.Command{
+	Use:   "upgrade [package[@constraint]...]",
+	Short: "Upgrades packages of the active bundle to their wanted version",
+	Long: `Upgrades packages of the active bundle to the newest version their constraint allows.
+Without arguments every package of the active bundle is upgraded; packages
+installed with an exact tag are pinned and skipped. A constraint or tag given
+on the command line (kubectl@^1.30, kubectl:1.30.2) replaces the recorded one.
+The new image is pulled, its shim deployed next to the old version and the
+symlink switched over.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+
+		resolver, err := environment.NewManifestResolver(e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		activeBundle := bundle.GetActiveBundle()
+		packages := bundle.GetInstalledPackages(activeBundle)
+
+		specs := make(map[string]string)
+		pkgs := args
+		if len(args) == 0 {
+			pkgs = sortedPackages(packages)
+		} else {
+			pkgs = make([]string, 0, len(args))
+			for _, arg := range args {
+				_, pkg, spec := parseIdentifier(arg)
+				if _, ok := packages[pkg]; !ok {
+					fmt.Fprintf(os.Stderr, "Error: package %q is not installed in bundle [%s]\n", pkg, activeBundle)
+					os.Exit(1)
+				}
+				pkgs = append(pkgs, pkg)
+				specs[pkg] = spec
+			}
+		}
+
+		regClient := e.RegistryClient()
+		failed := 0
+		for _, pkg := range pkgs {
+			if err := upgradePackage(e, regClient, bundle, resolver, pkg, specs[pkg]); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", pkg, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d package(s) in bundle [%s] could not be upgraded\n", failed, activeBundle)
+			os.Exit(1)
+		}
+	},
+}
+
+// upgradePackage moves pkg in the active bundle to its wanted version. An
+// explicit spec replaces the recorded constraint and may also downgrade.
+func upgradePackage(e *environment.Environment, regClient *container.RegistryClient, bundle *environment.Bundle, resolver *environment.ManifestResolver, pkg, spec string) error {
+	activeBundle := bundle.GetActiveBundle()
+	current := bundle.GetInstalledPackages(activeBundle)[pkg]
+
+	ma, pm, err := resolver.ResolveInstalled(bundle, activeBundle, pkg, current)
+	if err != nil {
+		return err
+	}
+
+	update, err := checkUpdate(regClient, bundle, activeBundle, pm, pkg, spec)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case update.Constraint == "":
+		fmt.Printf("📌 %s:%s is pinned, use %s@<constraint> to upgrade\n", pkg, current, pkg)
+		return nil
+	case update.Wanted == current:
+		if spec != "" {
+			bundle.SetPackageConstraint(activeBundle, pkg, current, constraintOf(spec))
+			return bundle.SaveBundle(e)
+		}
+		fmt.Printf("✅ %s:%s is up to date\n", pkg, current)
+		return nil
+	case spec == "" && semver.Compare(update.Wanted, current) < 0:
+		fmt.Printf("✅ %s:%s is newer than %s allows, keeping it\n", pkg, current, update.Constraint)
+		return nil
+	}
+
+	version := update.Wanted
+	digest, err := resolveDigest(context.TODO(), regClient, pm, version, "", false)
+	if err != nil {
+		return err
+	}
+
+	op, err := e.BeginOperation("upgrade", activeBundle)
+	if err != nil {
+		return err
+	}
+	if err := upgradeArtifact(e, bundle, op, ma, pm, pkg, current, version, digest, update.Constraint); err != nil {
+		if rollbackErr := op.Finish(); rollbackErr != nil {
+			fmt.Fprintf(os.Stderr, "Error rolling back %s: %v\n", op.Name, rollbackErr)
+		}
+		return err
+	}
+	finishOperation(op)
+	relinkBundle(e, bundle)
+
+	fmt.Printf("⬆️  Upgraded %s from %s to %s in bundle [%s]\n", pkg, current, version, activeBundle)
+	return nil
+}
+
+// upgradeArtifact deploys pkg:version and commits it to the active bundle in
+// place of current as part of op.
+func upgradeArtifact(e *environment.Environment, bundle *environment.Bundle, op *environment.Operation, ma *environment.ManifestArchive, pm *schema.PackageManifest, pkg, current, version, digest, constraint string) error {
+	if err := op.Creates(pkg, version); err != nil {
+		return err
+	}
+	if err := deployPackage(e, ma, pm, pkg, version, digest); err != nil {
+		return err
+	}
+
+	activeBundle := bundle.GetActiveBundle()
+	if upgradeRemoveOldFlag {
+		references, err := e.ArtifactReferences(bundle, environment.Artifact{Package: pkg, Version: current})
+		if err != nil {
+			return err
+		}
+		// The active bundle lets go of it with this upgrade
+		references = slices.DeleteFunc(references, func(name string) bool { return name == activeBundle })
+		if len(references) > 0 {
+			fmt.Printf("Keeping %s:%s, it is still used by %s\n", pkg, current, strings.Join(references, ", "))
+		} else if err := op.Obsoletes(pkg, current); err != nil {
+			return err
+		}
+	}
+
+	if err := bundle.AddPackage(activeBundle, pkg, version); err != nil {
+		return err
+	}
+	bundle.SetPackageNamespace(activeBundle, pkg, version, ma.Namespace)
+	if digest != "" {
+		bundle.SetPackageDigest(activeBundle, pkg, version, digest)
+	}
+	bundle.SetPackageConstraint(activeBundle, pkg, version, constraintOf(constraint))
+
+	if err := op.Commit(bundle); err != nil {
+		return fmt.Errorf("Error saving bundle: %w", err)
+	}
+	return nil
+}
+
+// constraintOf returns spec if it is a constraint and an empty string, which
+// pins the version, if it is a literal tag.
+func constraintOf(spec string) string {
+	if isVersionConstraint(spec) {
+		return spec
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/arafat/please/environment"
+	"github.com/arafat/please/utils/semver"
+	"github.com/spf13/cobra"
+)
+
+var UseCmd = &cobra.Command{
+	Use:   "use <pkg>@<version>",
+	Short: "Selects the version a package's executables run by default",
+	Long: `Selects the version the plain executable names of a package run in the active
+bundle, python@3.12 for instance. The previous default stays available as
+<executable>@<version>. A version that is not in the bundle yet is added if it
+is installed already; otherwise install it with please install <pkg>:<version>
+--keep. The version may also be a constraint such as python@~3.11.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, spec := parseIdentifier(args[0])
+		if spec == "" {
+			fmt.Fprintln(os.Stderr, "Error: missing version, use <pkg>@<version>")
+			os.Exit(1)
+		}
+
+		e := environment.New()
+		if !e.IsInitialized() {
+			fmt.Println("Please has not been initialized yet. Run please init.")
+			return
+		}
+
+		bundle, err := environment.LoadBundleDefinitions(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle definitions: %v\n", err)
+			os.Exit(1)
+		}
+		activeBundle := bundle.GetActiveBundle()
+
+		inBundle := bundle.GetPackageVersions(activeBundle, pkg)
+		installed, err := installedVersions(e, pkg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		version := spec
+		if semver.IsConstraint(spec) {
+			// Prefer the versions the bundle has over merely installed ones
+			if version, err = semver.Resolve(spec, inBundle); err != nil {
+				version, err = semver.Resolve(spec, installed)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: no installed version of %s matches %q\n", pkg, spec)
+				os.Exit(1)
+			}
+		}
+
+		switch {
+		case slices.Contains(inBundle, version):
+		case slices.Contains(installed, version):
+			if err := addInstalledVersion(bundle, activeBundle, pkg, version); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %s:%s is not installed, run please install %s:%s --keep\n", pkg, version, pkg, version)
+			os.Exit(1)
+		}
+
+		if err := bundle.UsePackageVersion(activeBundle, pkg, version); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := bundle.SaveBundle(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving bundle: %v\n", err)
+			os.Exit(1)
+		}
+		relinkBundle(e, bundle)
+
+		fmt.Printf("✅ %s now runs %s:%s in bundle [%s]\n", pkg, pkg, version, activeBundle)
+	},
+}
+
+// installedVersions lists the versions of pkg in the versions directory.
+func installedVersions(e *environment.Environment, pkg string) ([]string, error) {
+	artifacts, err := e.InstalledArtifacts()
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, a := range artifacts {
+		if a.Package == pkg {
+			versions = append(versions, a.Version)
+		}
+	}
+	return versions, nil
+}
+
+// addInstalledVersion adds a version another bundle or project installed to
+// bundleName, taking over the namespace and digest a bundle recorded for it.
+func addInstalledVersion(bundle *environment.Bundle, bundleName, pkg, version string) error {
+	if err := bundle.AddPackageVersion(bundleName, pkg, version); err != nil {
+		return err
+	}
+	for _, other := range bundle.BundlesUsing(pkg, version) {
+		if other == bundleName {
+			continue
+		}
+		if namespace := bundle.GetPackageNamespace(other, pkg, version); namespace != "" {
+			bundle.SetPackageNamespace(bundleName, pkg, version, namespace)
+		}
+		if digest := bundle.GetPackageDigest(other, pkg, version); digest != "" {
+			bundle.SetPackageDigest(bundleName, pkg, version, digest)
+		}
+		break
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/arafat/please/environment"
+	"github.com/spf13/cobra"
+)
+
+var VersionsCmd = &cobra.Command{
+	Use:   "versions [namespace:]<package>",
+	Short: "Lists the available versions of a package",
+	Long: `Lists the available versions of a package, newest first.
+For packages with version discovery the registry is queried and the remaining
+rate-limit budget it reports is shown.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := environment.New()
+		namespace, pkg := parsePackageName(args[0])
+
+		resolver, err := environment.NewManifestResolver(e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		_, pm, err := resolver.Resolve(namespace, pkg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if pm.VersionDiscovery == nil {
+			fmt.Printf("%d version(s) of %s:\n", len(pm.Versions), pkg)
+			for _, v := range pm.Versions {
+				fmt.Printf("- %s\n", v)
+			}
+			return
+		}
+
+		regClient := e.RegistryClient()
+		versions, err := regClient.ListVersions(context.Background(), pm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching versions: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%d version(s) of %s:\n", len(versions), pkg)
+		for _, v := range versions {
+			fmt.Printf("- %s\n", v)
+		}
+
+		// Manifest HEAD requests do not count against pull limits but report them
+		if len(versions) > 0 {
+			if _, err := regClient.ResolveDigest(context.Background(), pm.Image, versions[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Registry rate limit: unknown, %v\n", err)
+				return
+			}
+		}
+		if limit, ok := regClient.RateLimitForImage(pm.Image); ok {
+			fmt.Printf("Registry rate limit: %s\n", limit)
+		} else {
+			fmt.Println("Registry rate limit: not reported")
+		}
+	},
+}
@@ -0,0 +1,238 @@
+// Package config loads please's settings from ~/.please/config.toml and an
+// optional .please.toml in the project directory that overrides some of them.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/arafat/please/container"
+)
+
+const (
+	FileName        = "config.toml"
+	ProjectFileName = ".please.toml"
+
+	// HomeEnv overrides the please directory, ~/.please by default.
+	HomeEnv = "PLEASE_HOME"
+
+	DefaultSourceURL = "https://please.oarafat.workers.dev/manifest-core.tar.gz"
+)
+
+// projectKeys are the settings a project file may override. The file comes
+// with the repository, so it must not choose the runtime, the manifest source,
+// the proxy or the flags and variables of every container.
+var projectKeys = []string{"install.prompt", "platform"}
+
+// Install prompt modes, applied when a package is installed without version.
+const (
+	PromptAlways = "always"
+	PromptNever  = "never"
+	PromptAuto   = "auto"
+)
+
+type Config struct {
+	// Runtime is the container runtime, detected from PATH if empty.
+	Runtime string `toml:"runtime"`
+	// Platform is the platform images are pulled for, e.g. linux/arm64.
+	Platform string `toml:"platform"`
+	// DefaultNamespace is searched first for packages given without namespace.
+	DefaultNamespace string `toml:"default_namespace"`
+	// Source is the manifest source written to a new sources file.
+	Source  string        `toml:"source"`
+	HTTP    HTTPConfig    `toml:"http"`
+	Install InstallConfig `toml:"install"`
+	Shim    ShimConfig    `toml:"shim"`
+}
+
+type HTTPConfig struct {
+	// Proxy is used for all requests; $HTTPS_PROXY and friends apply if empty.
+	Proxy   string        `toml:"proxy"`
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type InstallConfig struct {
+	// Prompt decides whether the version picker is shown: always, never
+	// (install the default or latest version) or auto (only on a terminal).
+	Prompt string `toml:"prompt"`
+}
+
+type ShimConfig struct {
+	// ExtraFlags are added to every container run, e.g. --network=host.
+	ExtraFlags []string `toml:"extra_flags"`
+	// PassEnv names host variables passed through to every container.
+	PassEnv []string `toml:"pass_env"`
+}
+
+// Default returns the settings used when no configuration file sets them.
+func Default() *Config {
+	return &Config{
+		Platform: "linux/" + strings.ToLower(runtime.GOARCH), // no darwin images available
+		Source:   DefaultSourceURL,
+		HTTP:     HTTPConfig{Timeout: 2 * time.Minute},
+		Install:  InstallConfig{Prompt: PromptAuto},
+	}
+}
+
+// PleasePath returns the please directory, $PLEASE_HOME or ~/.please.
+func PleasePath() string {
+	if path := os.Getenv(HomeEnv); path != "" {
+		return path
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".please")
+}
+
+// Load reads the global configuration file and the project file found from
+// workDir upwards on top of the defaults. Missing files are skipped, a project
+// file setting a key other than the project keys is an error.
+func Load(globalPath, workDir string) (*Config, error) {
+	c := Default()
+	if err := c.merge(globalPath, false); err != nil {
+		return nil, err
+	}
+
+	if workDir != "" {
+		projectPath, err := FindProjectFile(workDir)
+		if err != nil {
+			return nil, err
+		}
+		if projectPath != "" {
+			if err := c.merge(projectPath, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// merge decodes path over c, rejecting keys it does not know and, for a
+// project file, keys it may not set.
+func (c *Config) merge(path string, project bool) error {
+	md, err := toml.DecodeFile(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+	}
+	if project {
+		for _, key := range md.Keys() {
+			if !IsProjectKey(key.String()) && !isProjectTable(key.String()) {
+				return fmt.Errorf("%s: %q cannot be set in a project file, only %s", path, key.String(), strings.Join(projectKeys, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// IsProjectKey reports whether a project file may set key.
+func IsProjectKey(key string) bool {
+	return slices.Contains(projectKeys, key)
+}
+
+func isProjectTable(key string) bool {
+	for _, k := range projectKeys {
+		if strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// FindProjectFile walks up from dir and returns the path of the first project
+// configuration file, or an empty string if there is none.
+func FindProjectFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		candidate := filepath.Join(dir, ProjectFileName)
+		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Validate checks that every setting holds a supported value.
+func (c *Config) Validate() error {
+	if c.Runtime != "" && !slices.Contains(container.RuntimeNames(), c.Runtime) {
+		return fmt.Errorf("invalid runtime %q, supported are %s", c.Runtime, strings.Join(container.RuntimeNames(), ", "))
+	}
+
+	goos, arch, ok := strings.Cut(c.Platform, "/")
+	if !ok || goos == "" || arch == "" {
+		return fmt.Errorf("invalid platform %q, expected <os>/<arch>", c.Platform)
+	}
+
+	if c.Source != "" {
+		if u, err := url.Parse(c.Source); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid source %q, expected an http(s) URL", c.Source)
+		}
+	}
+
+	if c.HTTP.Proxy != "" {
+		if u, err := url.Parse(c.HTTP.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid http.proxy %q, expected a URL", c.HTTP.Proxy)
+		}
+	}
+	if c.HTTP.Timeout < 0 {
+		return fmt.Errorf("invalid http.timeout %s, must not be negative", c.HTTP.Timeout)
+	}
+
+	switch c.Install.Prompt {
+	case PromptAlways, PromptNever, PromptAuto:
+	default:
+		return fmt.Errorf("invalid install.prompt %q, expected %s, %s or %s", c.Install.Prompt, PromptAlways, PromptNever, PromptAuto)
+	}
+
+	return nil
+}
+
+// OS returns the operating system part of the platform.
+func (c *Config) OS() string {
+	goos, _, _ := strings.Cut(c.Platform, "/")
+	return goos
+}
+
+// Arch returns the architecture part of the platform.
+func (c *Config) Arch() string {
+	_, arch, _ := strings.Cut(c.Platform, "/")
+	return arch
+}
+
+// HTTPClient returns a client using the configured proxy and timeout.
+func (c *Config) HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.HTTP.Proxy != "" {
+		if proxy, err := url.Parse(c.HTTP.Proxy); err == nil {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: c.HTTP.Timeout}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults without files", func(t *testing.T) {
+		dir := t.TempDir()
+
+		c, err := Load(filepath.Join(dir, FileName), dir)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if c.Install.Prompt != PromptAuto {
+			t.Errorf("expected prompt auto, got %s", c.Install.Prompt)
+		}
+		if c.OS() != "linux" {
+			t.Errorf("expected linux, got %s", c.OS())
+		}
+	})
+
+	t.Run("project overrides global", func(t *testing.T) {
+		dir := t.TempDir()
+		global := filepath.Join(dir, "home", FileName)
+		writeFile(t, global, `
+runtime = "podman"
+platform = "linux/amd64"
+
+[http]
+timeout = "30s"
+
+[shim]
+extra_flags = ["--network=host"]
+`)
+		project := filepath.Join(dir, "project")
+		writeFile(t, filepath.Join(project, ProjectFileName), `
+platform = "linux/arm64"
+
+[install]
+prompt = "never"
+`)
+		workDir := filepath.Join(project, "src")
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := Load(global, workDir)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if c.Runtime != "podman" {
+			t.Errorf("expected podman, got %s", c.Runtime)
+		}
+		if c.Arch() != "arm64" {
+			t.Errorf("expected arm64, got %s", c.Arch())
+		}
+		if c.Install.Prompt != PromptNever {
+			t.Errorf("expected prompt never, got %s", c.Install.Prompt)
+		}
+		if c.HTTP.Timeout != 30*time.Second {
+			t.Errorf("expected 30s, got %s", c.HTTP.Timeout)
+		}
+		if !slices.Equal(c.Shim.ExtraFlags, []string{"--network=host"}) {
+			t.Errorf("expected [--network=host], got %v", c.Shim.ExtraFlags)
+		}
+	})
+
+	t.Run("project cannot set other keys", func(t *testing.T) {
+		for _, content := range []string{
+			`runtime = "docker"`,
+			`source = "https://example.com/manifests.tar.gz"`,
+			"[shim]\nextra_flags = [\"--privileged\"]",
+			"[http]\nproxy = \"http://proxy.example.com\"",
+		} {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, ProjectFileName), content)
+
+			if _, err := Load(filepath.Join(dir, FileName), dir); err == nil {
+				t.Errorf("expected error for %q, got nil", content)
+			}
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, FileName), `runtim = "docker"`)
+
+		if _, err := Load(filepath.Join(dir, FileName), ""); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, FileName), `runtime = "lxc"`)
+
+		if _, err := Load(filepath.Join(dir, FileName), ""); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestSet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+
+	t.Run("typed values round trip", func(t *testing.T) {
+		settings := map[string]string{
+			"runtime":           "nerdctl",
+			"http.timeout":      "45s",
+			"shim.pass_env":     "AWS_PROFILE,KUBECONFIG",
+			"install.prompt":    "never",
+			"http.proxy":        "http://proxy.internal:3128",
+			"platform":          "linux/arm64",
+			"default_namespace": "internal",
+		}
+		for key, value := range settings {
+			if err := Set(path, key, value); err != nil {
+				t.Fatalf("expected no error setting %s, got %v", key, err)
+			}
+		}
+
+		c, err := Load(path, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for key, expected := range settings {
+			got, err := c.Get(key)
+			if err != nil {
+				t.Fatalf("expected no error getting %s, got %v", key, err)
+			}
+			if got != expected {
+				t.Errorf("expected %s = %q, got %q", key, expected, got)
+			}
+		}
+	})
+
+	t.Run("empty value restores default", func(t *testing.T) {
+		if err := Set(path, "install.prompt", ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		c, err := Load(path, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if c.Install.Prompt != PromptAuto {
+			t.Errorf("expected auto, got %s", c.Install.Prompt)
+		}
+	})
+
+	t.Run("invalid values are rejected", func(t *testing.T) {
+		invalid := map[string]string{
+			"install.prompt": "sometimes",
+			"http.timeout":   "soon",
+			"platform":       "arm64",
+			"runtime":        "lxc",
+			"unknown":        "x",
+			"http":           "x",
+		}
+		for key, value := range invalid {
+			if err := Set(path, key, value); err == nil {
+				t.Errorf("expected error setting %s = %q, got nil", key, value)
+			}
+		}
+
+		c, err := Load(path, "")
+		if err != nil {
+			t.Fatalf("expected file to stay valid, got %v", err)
+		}
+		if c.Runtime != "nerdctl" {
+			t.Errorf("expected nerdctl, got %s", c.Runtime)
+		}
+	})
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys()
+	for _, key := range []string{"runtime", "http.proxy", "http.timeout", "install.prompt", "shim.extra_flags"} {
+		if !slices.Contains(keys, key) {
+			t.Errorf("expected %s in %v", key, keys)
+		}
+	}
+}
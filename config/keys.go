@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Keys returns the dotted names of all settings, e.g. http.timeout.
+func Keys() []string {
+	var keys []string
+	collectKeys(reflect.TypeOf(Config{}), "", &keys)
+	sort.Strings(keys)
+	return keys
+}
+
+func collectKeys(t reflect.Type, prefix string, keys *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := prefix + f.Tag.Get("toml")
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			collectKeys(f.Type, name+".", keys)
+			continue
+		}
+		*keys = append(*keys, name)
+	}
+}
+
+// field returns the settable field of c named by a dotted key.
+func (c *Config) field(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct || v.Type() == durationType {
+			return reflect.Value{}, fmt.Errorf("unknown key %q", key)
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("toml") == part {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if v.Kind() == reflect.Struct && v.Type() != durationType {
+		return reflect.Value{}, fmt.Errorf("%q is a table, use one of its keys", key)
+	}
+	return v, nil
+}
+
+// Get returns the value of key formatted as set would accept it. Lists are
+// comma separated.
+func (c *Config) Get(key string) (string, error) {
+	v, err := c.field(key)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case v.Type() == durationType:
+		return v.Interface().(time.Duration).String(), nil
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ","), nil
+	default:
+		return v.String(), nil
+	}
+}
+
+// parseValue converts value to the type of key and returns it in the form
+// written to the configuration file.
+func parseValue(key, value string) (any, error) {
+	v, err := Default().field(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v.Type() == durationType:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+		return value, nil
+	case v.Kind() == reflect.Slice:
+		values := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		return values, nil
+	default:
+		return value, nil
+	}
+}
+
+// Set writes key = value to the configuration file at path after checking
+// that the resulting configuration is valid. An empty value removes the key.
+func Set(path, key, value string) error {
+	typed, err := parseValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]any)
+	if _, err := toml.DecodeFile(path, &values); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	table := values
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		sub, ok := table[part].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			table[part] = sub
+		}
+		table = sub
+	}
+	if value == "" {
+		delete(table, parts[len(parts)-1])
+	} else {
+		table[parts[len(parts)-1]] = typed
+	}
+
+	// Validate the file on its own merged over the defaults
+	var buf strings.Builder
+	if err := toml.NewEncoder(&buf).Encode(values); err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	c := Default()
+	if _, err := toml.Decode(buf.String(), c); err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
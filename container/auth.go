@@ -0,0 +1,220 @@
+package container
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTokenLifetime applies when a token service omits expires_in.
+const defaultTokenLifetime = 60 * time.Second
+
+// authChallenge is a parsed WWW-Authenticate header.
+type authChallenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+type cachedToken struct {
+	authorization string
+	expires       time.Time
+}
+
+// parseAuthChallenge parses headers such as
+// Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseAuthChallenge(header string) (*authChallenge, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if scheme == "" {
+		return nil, fmt.Errorf("empty WWW-Authenticate header")
+	}
+
+	c := &authChallenge{Scheme: strings.ToLower(scheme), Params: make(map[string]string)}
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed WWW-Authenticate header %q", header)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("malformed WWW-Authenticate header %q", header)
+			}
+			c.Params[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			v, remainder, _ := strings.Cut(value, ",")
+			c.Params[key] = strings.TrimSpace(v)
+			rest = "," + remainder
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), ","))
+	}
+
+	return c, nil
+}
+
+// authorize returns the Authorization header value for pulling repository
+// from registry, or an empty string if the registry allows anonymous access
+// without a token.
+func (c *RegistryClient) authorize(ctx context.Context, registry, repository string) (string, error) {
+	scope := fmt.Sprintf("repository:%s:pull", repository)
+	cacheKey := registry + "|" + scope
+
+	c.mu.Lock()
+	cached, ok := c.tokens[cacheKey]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.authorization, nil
+	}
+
+	c.mu.Lock()
+	challenge, probed := c.challenges[registry]
+	c.mu.Unlock()
+	if !probed {
+		var err error
+		if challenge, err = c.probe(ctx, registry); err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		c.challenges[registry] = challenge
+		c.mu.Unlock()
+	}
+	if challenge == nil {
+		return "", nil
+	}
+
+	creds, err := c.credentials.Lookup(registry)
+	if err != nil {
+		return "", err
+	}
+
+	var token cachedToken
+	switch challenge.Scheme {
+	case "basic":
+		if creds == nil {
+			return "", fmt.Errorf("registry %s requires credentials", registry)
+		}
+		token = cachedToken{
+			authorization: "Basic " + basicAuth(creds),
+			expires:       time.Now().Add(time.Hour),
+		}
+	case "bearer":
+		token, err = c.fetchToken(ctx, challenge, scope, creds)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported authentication scheme %q", challenge.Scheme)
+	}
+
+	c.mu.Lock()
+	c.tokens[cacheKey] = token
+	c.mu.Unlock()
+	return token.authorization, nil
+}
+
+// probe requests /v2/ and returns the authentication challenge, or nil if
+// the registry does not ask for authentication.
+func (c *RegistryClient) probe(ctx context.Context, registry string) (*authChallenge, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/v2/", registry), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, nil
+	}
+
+	header := resp.Header.Get("WWW-Authenticate")
+	if header == "" {
+		return nil, fmt.Errorf("registry %s requires authentication but sent no challenge", registry)
+	}
+	return parseAuthChallenge(header)
+}
+
+// fetchToken requests a bearer token from the realm of the challenge.
+func (c *RegistryClient) fetchToken(ctx context.Context, challenge *authChallenge, scope string, creds *Credentials) (cachedToken, error) {
+	realm := challenge.Params["realm"]
+	if realm == "" {
+		return cachedToken{}, fmt.Errorf("bearer challenge without realm")
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("invalid realm %q: %w", realm, err)
+	}
+	query := tokenURL.Query()
+	if service := challenge.Params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	if creds != nil {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cachedToken{}, fmt.Errorf("auth request failed: %d", resp.StatusCode)
+	}
+
+	var authResp struct {
+		Token       string    `json:"token"`
+		AccessToken string    `json:"access_token"`
+		ExpiresIn   int       `json:"expires_in"`
+		IssuedAt    time.Time `json:"issued_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return cachedToken{}, err
+	}
+
+	token := authResp.Token
+	if token == "" {
+		token = authResp.AccessToken
+	}
+	if token == "" {
+		return cachedToken{}, fmt.Errorf("token service returned no token")
+	}
+
+	issued := authResp.IssuedAt
+	if issued.IsZero() {
+		issued = time.Now()
+	}
+	lifetime := defaultTokenLifetime
+	if authResp.ExpiresIn > 0 {
+		lifetime = time.Duration(authResp.ExpiresIn) * time.Second
+	}
+
+	return cachedToken{
+		authorization: "Bearer " + token,
+		// Renew slightly early so a token never expires mid-request
+		expires: issued.Add(lifetime - 5*time.Second),
+	}, nil
+}
+
+func basicAuth(creds *Credentials) string {
+	return base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+}
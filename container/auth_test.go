@@ -0,0 +1,141 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestParseAuthChallenge(t *testing.T) {
+	c, err := parseAuthChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if c.Scheme != "bearer" {
+		t.Errorf("expected bearer, got %s", c.Scheme)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull",
+	}
+	for k, v := range expected {
+		if c.Params[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, c.Params[k])
+		}
+	}
+}
+
+func TestAuthorizeBearerChallenge(t *testing.T) {
+	tokenRequests := 0
+	var realm string
+	client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			tokenRequests++
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "alice" || pass != "secret" || r.URL.Query().Get("scope") != "repository:team/tool:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"token": "t0k3n", "expires_in": 300})
+		case "/v2/team/tool/tags/list":
+			if r.Header.Get("Authorization") != "Bearer t0k3n" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"name": "team/tool", "tags": []string{"1.0.0", "1.1.0"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	realm = "https://" + host + "/token"
+
+	credsFile := filepath.Join(t.TempDir(), "credentials.json")
+	data, _ := json.Marshal(pleaseCredentials{Registries: map[string]Credentials{host: {Username: "alice", Password: "secret"}}})
+	if err := os.WriteFile(credsFile, data, 0600); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	client.credentials = &CredentialStore{PleaseFile: credsFile, DockerConfig: filepath.Join(t.TempDir(), "missing.json")}
+
+	manifest := &schema.PackageManifest{Image: host + "/team/tool", VersionDiscovery: &schema.VersionDiscovery{}}
+	for i := 0; i < 2; i++ {
+		versions, err := client.ListVersions(context.Background(), manifest)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(versions) != 2 || versions[0] != "1.1.0" {
+			t.Errorf("unexpected versions %v", versions)
+		}
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("expected token to be cached, got %d token requests", tokenRequests)
+	}
+}
+
+func TestAuthorizeAnonymousRegistry(t *testing.T) {
+	probes := 0
+	client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			probes++
+		default:
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		}
+	})
+
+	for _, image := range []string{host + "/tools/jq", host + "/tools/yq", host + "/tools/jq"} {
+		if _, err := client.ResolveDigest(context.Background(), image, "1.0"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if probes != 1 {
+		t.Errorf("expected the registry to be probed once, got %d probes", probes)
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"Ym9iOmh1bnRlcjI="}}}`), 0600); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	store := &CredentialStore{PleaseFile: filepath.Join(dir, "missing.json"), DockerConfig: config}
+
+	creds, err := store.Lookup("registry-1.docker.io")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if creds == nil || creds.Username != "bob" || creds.Password != "hunter2" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
+
+func TestPleaseFileCredentials(t *testing.T) {
+	pleasePath := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	if err := os.WriteFile(filepath.Join(pleasePath, "credentials.json"), []byte(`{"registries":{"ghcr.io":{"username":"bob","password":"hunter2"}}}`), 0600); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	creds, err := NewCredentialStore(pleasePath).Lookup("ghcr.io")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if creds == nil || creds.Username != "bob" || creds.Password != "hunter2" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
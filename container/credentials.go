@@ -0,0 +1,171 @@
+package container
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dockerHubServer is the key docker uses for Docker Hub credentials.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// Credentials authenticate against a registry's token service.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CredentialStore looks up registry credentials in the please credentials
+// file first and in the docker CLI configuration second.
+type CredentialStore struct {
+	PleaseFile   string
+	DockerConfig string
+}
+
+// NewCredentialStore returns the store reading credentials.json in the
+// please directory pleasePath and the docker configuration of the user.
+func NewCredentialStore(pleasePath string) *CredentialStore {
+	homeDir, _ := os.UserHomeDir()
+
+	dockerConfigDir := os.Getenv("DOCKER_CONFIG")
+	if dockerConfigDir == "" {
+		dockerConfigDir = filepath.Join(homeDir, ".docker")
+	}
+
+	return &CredentialStore{
+		PleaseFile:   filepath.Join(pleasePath, "credentials.json"),
+		DockerConfig: filepath.Join(dockerConfigDir, "config.json"),
+	}
+}
+
+type pleaseCredentials struct {
+	Registries map[string]Credentials `json:"registries"`
+}
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// Lookup returns the credentials for registry or nil if none are configured.
+func (s *CredentialStore) Lookup(registry string) (*Credentials, error) {
+	if creds, err := s.lookupPleaseFile(registry); creds != nil || err != nil {
+		return creds, err
+	}
+	return s.lookupDockerConfig(registry)
+}
+
+func (s *CredentialStore) lookupPleaseFile(registry string) (*Credentials, error) {
+	data, err := os.ReadFile(s.PleaseFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.PleaseFile, err)
+	}
+
+	var file pleaseCredentials
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", s.PleaseFile, err)
+	}
+
+	for _, key := range registryKeys(registry) {
+		if creds, ok := file.Registries[key]; ok {
+			return &creds, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *CredentialStore) lookupDockerConfig(registry string) (*Credentials, error) {
+	data, err := os.ReadFile(s.DockerConfig)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.DockerConfig, err)
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", s.DockerConfig, err)
+	}
+
+	keys := registryKeys(registry)
+	for _, key := range keys {
+		if helper, ok := config.CredHelpers[key]; ok {
+			return credentialHelperGet(helper, key)
+		}
+	}
+
+	for _, key := range keys {
+		entry, ok := config.Auths[key]
+		if !ok || entry.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth entry for %s: %w", key, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid auth entry for %s", key)
+		}
+		return &Credentials{Username: username, Password: password}, nil
+	}
+
+	if config.CredsStore != "" {
+		return credentialHelperGet(config.CredsStore, keys[0])
+	}
+	return nil, nil
+}
+
+// registryKeys returns the keys a registry may be stored under, most
+// specific first.
+func registryKeys(registry string) []string {
+	if strings.Contains(registry, "docker.io") {
+		return []string{dockerHubServer, "docker.io", "index.docker.io", registry}
+	}
+	return []string{registry, "https://" + registry}
+}
+
+// credentialHelperGet runs docker-credential-<helper> get for server. A
+// missing helper or unknown server yields no credentials.
+func credentialHelperGet(helper, server string) (*Credentials, error) {
+	binary := "docker-credential-" + helper
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, nil
+	}
+
+	cmd := exec.Command(path, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		// Helpers exit non-zero with "credentials not found in native keychain"
+		return nil, nil
+	}
+
+	var resp struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s output: %w", binary, err)
+	}
+	if resp.Username == "<token>" {
+		// Identity tokens need an OAuth2 refresh flow that is not supported
+		return nil, nil
+	}
+	return &Credentials{Username: resp.Username, Password: resp.Secret}, nil
+}
@@ -0,0 +1,151 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	// maxRetryAfter bounds how long a single Retry-After is waited for
+	maxRetryAfter = time.Minute
+)
+
+// RateLimit is the request budget a registry last reported through its
+// RateLimit-* headers.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Window    time.Duration
+	Reset     time.Duration
+}
+
+func (r RateLimit) String() string {
+	s := fmt.Sprintf("%d/%d requests remaining", r.Remaining, r.Limit)
+	if r.Window > 0 {
+		s += fmt.Sprintf(" per %s", r.Window)
+	}
+	if r.Reset > 0 {
+		s += fmt.Sprintf(", resets in %s", r.Reset)
+	}
+	return s
+}
+
+// RateLimit returns the last budget reported by registry, if any.
+func (c *RegistryClient) RateLimit(registry string) (RateLimit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.rateLimits[registry]
+	return r, ok
+}
+
+// RateLimitForImage returns the last budget reported by the registry of image.
+func (c *RegistryClient) RateLimitForImage(image string) (RateLimit, bool) {
+	registry, _ := parseImageReference(image)
+	return c.RateLimit(registry)
+}
+
+// do sends a body-less request, records rate-limit headers and retries on
+// HTTP 429 honouring Retry-After or backing off exponentially.
+func (c *RegistryClient) do(req *http.Request) (*http.Response, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpClient.Do(req.Clone(req.Context()))
+		if err != nil {
+			return nil, err
+		}
+		c.recordRateLimit(req.URL.Host, resp.Header)
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			wait = backoff
+			backoff *= 2
+		}
+		if attempt >= c.maxRetries || wait > maxRetryAfter {
+			return nil, fmt.Errorf("rate limited by %s, retry after %s", req.URL.Host, wait.Round(time.Second))
+		}
+
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *RegistryClient) recordRateLimit(host string, header http.Header) {
+	limit, limitWindow, okLimit := parseRateLimitValue(header.Get("RateLimit-Limit"))
+	remaining, _, okRemaining := parseRateLimitValue(header.Get("RateLimit-Remaining"))
+	if !okLimit || !okRemaining {
+		return
+	}
+
+	r := RateLimit{Limit: limit, Remaining: remaining, Window: limitWindow}
+	if reset, err := strconv.Atoi(strings.TrimSpace(header.Get("RateLimit-Reset"))); err == nil {
+		r.Reset = time.Duration(reset) * time.Second
+	}
+
+	c.mu.Lock()
+	c.rateLimits[host] = r
+	c.mu.Unlock()
+}
+
+// parseRateLimitValue parses values such as "100;w=21600".
+func parseRateLimitValue(value string) (n int, window time.Duration, ok bool) {
+	if value == "" {
+		return 0, 0, false
+	}
+
+	parts := strings.Split(value, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	for _, p := range parts[1:] {
+		if w, found := strings.CutPrefix(strings.TrimSpace(p), "w="); found {
+			if seconds, err := strconv.Atoi(w); err == nil {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return n, window, true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
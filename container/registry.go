@@ -5,22 +5,50 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/arafat/please/schema"
+	"github.com/arafat/please/utils/semver"
 )
 
 // RegistryClient handles communication with container registries
 type RegistryClient struct {
-	httpClient *http.Client
+	httpClient  *http.Client
+	credentials *CredentialStore
+
+	maxRetries int
+	backoff    time.Duration
+
+	mu         sync.Mutex
+	tokens     map[string]cachedToken
+	rateLimits map[string]RateLimit
+	// challenges caches the probe of each registry, nil if it is anonymous
+	challenges map[string]*authChallenge
 }
 
-func NewRegistryClient() *RegistryClient {
+// NewRegistryClient returns a client sending its requests through httpClient,
+// or a default client if it is nil, and authenticating with credentials, or
+// anonymously if it is nil.
+func NewRegistryClient(httpClient *http.Client, credentials *CredentialStore) *RegistryClient {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	if credentials == nil {
+		credentials = &CredentialStore{}
+	}
 	return &RegistryClient{
-		httpClient: &http.Client{},
+		httpClient:  httpClient,
+		credentials: credentials,
+		maxRetries:  defaultMaxRetries,
+		backoff:     defaultBackoff,
+		tokens:      make(map[string]cachedToken),
+		rateLimits:  make(map[string]RateLimit),
+		challenges:  make(map[string]*authChallenge),
 	}
 }
 
@@ -33,14 +61,14 @@ func (c *RegistryClient) ListVersions(ctx context.Context, manifest *schema.Pack
 	// Parse image reference (registry/repository:tag)
 	registry, repository := parseImageReference(manifest.Image)
 
-	// Get authentication token if needed
-	token, err := c.getAuthToken(ctx, registry, repository)
+	// Get authorization if needed
+	authorization, err := c.authorize(ctx, registry, repository)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get auth token: %w", err)
 	}
 
 	// Fetch all tags from the registry
-	tags, err := c.fetchTags(ctx, registry, repository, token)
+	tags, err := c.fetchTags(ctx, registry, repository, authorization)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch tags: %w", err)
 	}
@@ -54,6 +82,54 @@ func (c *RegistryClient) ListVersions(ctx context.Context, manifest *schema.Pack
 	return filtered, nil
 }
 
+// manifestMediaTypes are accepted when resolving digests. Index types come
+// first so that multi-platform images resolve to the digest of their index.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ResolveDigest returns the manifest digest the registry currently serves for
+// image:tag.
+func (c *RegistryClient) ResolveDigest(ctx context.Context, image, tag string) (string, error) {
+	registry, repository := parseImageReference(image)
+
+	authorization, err := c.authorize(ctx, registry, repository)
+	if err != nil {
+		return "", fmt.Errorf("failed to get auth token: %w", err)
+	}
+
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, tag)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to resolve digest for %s:%s: %d", image, tag, resp.StatusCode)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s:%s", image, tag)
+	}
+
+	return digest, nil
+}
+
 // parseImageReference splits image into registry and repository
 func parseImageReference(image string) (registry, repository string) {
 	parts := strings.SplitN(image, "/", 2)
@@ -80,72 +156,79 @@ func parseImageReference(image string) (registry, repository string) {
 	return "registry-1.docker.io", image
 }
 
-// getAuthToken obtains authentication token for the registry
-func (c *RegistryClient) getAuthToken(ctx context.Context, registry, repository string) (string, error) {
-	// For Docker Hub
-	if strings.Contains(registry, "docker.io") {
-		authURL := fmt.Sprintf("https://auth.docker.io/token?service=registry.docker.io&scope=repository:%s:pull", repository)
-		req, err := http.NewRequestWithContext(ctx, "GET", authURL, nil)
+// tagPageSize is the number of tags requested per page
+const tagPageSize = 1000
+
+// fetchTags retrieves all tags for an image from the registry, following the
+// Link header pagination
+func (c *RegistryClient) fetchTags(ctx context.Context, registry, repository, authorization string) ([]string, error) {
+	next := fmt.Sprintf("https://%s/v2/%s/tags/list?n=%d", registry, repository, tagPageSize)
+
+	var tags []string
+	fetched := make(map[string]bool)
+	for next != "" {
+		// A Link header pointing back to a fetched page would never end
+		if fetched[next] {
+			return nil, fmt.Errorf("failed to fetch tags: page %s was already fetched", next)
+		}
+		fetched[next] = true
+
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
 		}
 
-		resp, err := c.httpClient.Do(req)
+		resp, err := c.do(req)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("auth request failed: %d", resp.StatusCode)
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to fetch tags: %d", resp.StatusCode)
 		}
 
-		var authResp struct {
-			Token string `json:"token"`
+		var tagsResp struct {
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-			return "", err
+		err = json.NewDecoder(resp.Body).Decode(&tagsResp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
 		}
+		tags = append(tags, tagsResp.Tags...)
 
-		return authResp.Token, nil
+		next, err = nextPageURL(req.URL, resp.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// For other registries, might not need auth or use different mechanism
-	return "", nil
+	return tags, nil
 }
 
-// fetchTags retrieves all tags for an image from the registry
-func (c *RegistryClient) fetchTags(ctx context.Context, registry, repository, token string) ([]string, error) {
-	url := fmt.Sprintf("https://%s/v2/%s/tags/list", registry, repository)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	if token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch tags: %d", resp.StatusCode)
-	}
+// nextPageURL resolves the rel="next" target of a Link header against the
+// URL of the current page
+func nextPageURL(current *url.URL, link string) (string, error) {
+	for _, part := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+		if !ok || !strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+			continue
+		}
 
-	var tagsResp struct {
-		Name string   `json:"name"`
-		Tags []string `json:"tags"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&tagsResp); err != nil {
-		return nil, err
+		target = strings.Trim(strings.TrimSpace(target), "<>")
+		ref, err := url.Parse(target)
+		if err != nil {
+			return "", fmt.Errorf("invalid Link header %q: %w", link, err)
+		}
+		return current.ResolveReference(ref).String(), nil
 	}
-
-	return tagsResp.Tags, nil
+	return "", nil
 }
 
 // filterVersions applies the pattern and exclude rules to the version list
@@ -183,45 +266,8 @@ func filterVersions(versions []string, filter schema.VersionFilter) ([]string, e
 
 	// Sort versions semantically (latest first)
 	sort.Slice(filtered, func(i, j int) bool {
-		return compareVersions(filtered[i], filtered[j]) > 0
+		return semver.Compare(filtered[i], filtered[j]) > 0
 	})
 
 	return filtered, nil
 }
-
-// compareVersions compares two semantic version strings
-// Returns: 1 if v1 > v2, -1 if v1 < v2, 0 if equal
-func compareVersions(v1, v2 string) int {
-	// Strip 'v' prefix if present
-	v1 = strings.TrimPrefix(v1, "v")
-	v2 = strings.TrimPrefix(v2, "v")
-
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	// Compare each part
-	maxLen := len(parts1)
-	if len(parts2) > maxLen {
-		maxLen = len(parts2)
-	}
-
-	for i := 0; i < maxLen; i++ {
-		var n1, n2 int
-
-		if i < len(parts1) {
-			n1, _ = strconv.Atoi(parts1[i])
-		}
-		if i < len(parts2) {
-			n2, _ = strconv.Atoi(parts2[i])
-		}
-
-		if n1 > n2 {
-			return 1
-		}
-		if n1 < n2 {
-			return -1
-		}
-	}
-
-	return 0
-}
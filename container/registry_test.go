@@ -0,0 +1,141 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T, handler http.HandlerFunc) (*RegistryClient, string) {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewRegistryClient(server.Client(), nil)
+	return client, strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestResolveDigest(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodHead || r.URL.Path != "/v2/tools/jq/manifests/1.7" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		})
+
+		digest, err := client.ResolveDigest(context.Background(), host+"/tools/jq", "1.7")
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if digest != "sha256:abc" {
+			t.Errorf("expected sha256:abc, got %q", digest)
+		}
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		_, err := client.ResolveDigest(context.Background(), host+"/tools/jq", "0.0")
+
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestFetchTagsPagination(t *testing.T) {
+	pages := map[string]struct {
+		tags []string
+		next string
+	}{
+		"":      {[]string{"1.0.0", "1.1.0"}, "/v2/tools/node/tags/list?n=1000&last=1.1.0"},
+		"1.1.0": {[]string{"2.0.0"}, ""},
+	}
+	client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/tools/node/tags/list" || r.URL.Query().Get("n") != "1000" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		page := pages[r.URL.Query().Get("last")]
+		if page.next != "" {
+			w.Header().Set("Link", `<`+page.next+`>; rel="next"`)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "tools/node", "tags": page.tags})
+	})
+
+	tags, err := client.fetchTags(context.Background(), host, "tools/node", "")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(tags) != 3 || tags[2] != "2.0.0" {
+		t.Errorf("expected tags of both pages, got %v", tags)
+	}
+}
+
+func TestFetchTagsPaginationLoop(t *testing.T) {
+	requests := 0
+	client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Link", `</v2/tools/node/tags/list?n=1000&last=1.0.0>; rel="next"`)
+		json.NewEncoder(w).Encode(map[string]any{"name": "tools/node", "tags": []string{"1.0.0"}})
+	})
+
+	if _, err := client.fetchTags(context.Background(), host, "tools/node", ""); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if requests != 2 {
+		t.Errorf("expected to stop after 2 requests, got %d", requests)
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	requests := 0
+	client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d;w=21600", 100-requests))
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:abc")
+	})
+
+	digest, err := client.ResolveDigest(context.Background(), host+"/tools/jq", "1.7")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if digest != "sha256:abc" {
+		t.Errorf("expected sha256:abc, got %q", digest)
+	}
+	limit, ok := client.RateLimit(host)
+	if !ok || limit.Limit != 100 || limit.Remaining != 100-requests || limit.Window != 6*time.Hour {
+		t.Errorf("unexpected rate limit %+v", limit)
+	}
+}
+
+func TestRateLimitGivesUp(t *testing.T) {
+	client, host := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := client.ResolveDigest(context.Background(), host+"/tools/jq", "1.7")
+
+	if err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+}
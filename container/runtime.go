@@ -0,0 +1,448 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/arafat/please/schema"
+)
+
+// RuntimeEnv selects the container runtime by name and overrides detection.
+const RuntimeEnv = "PLEASE_RUNTIME"
+
+// Runtime is a container engine CLI that pulls images and runs the shims.
+type Runtime interface {
+	// Name is the runtime's binary name, which shims exec through PATH.
+	Name() string
+	Pull(ctx context.Context, reference, platform string) error
+	// RunArgs renders the arguments following the binary in a shim, one group
+	// of related arguments per line, e.g. {"--dns", "1.1.1.1"}.
+	RunArgs(opts RunOptions) []ArgGroup
+	Inspect(ctx context.Context, reference string) (*ImageInfo, error)
+	Remove(ctx context.Context, reference string) error
+	List(ctx context.Context) ([]Image, error)
+
+	// Start, Stop, Status and Logs control the detached containers of
+	// service packages by name.
+	Start(ctx context.Context, opts ServiceOptions) error
+	Stop(ctx context.Context, name string) error
+	Status(ctx context.Context, name string) (*ContainerStatus, error)
+	Logs(ctx context.Context, name string, follow bool, tail int) error
+}
+
+// RunOptions describes a shim's container invocation. The TTY mode of the
+// ContainerArgs decides whether RunArgs allocates a terminal.
+type RunOptions struct {
+	schema.ContainerArgs
+	Reference       string
+	Platform        string
+	Executable      string
+	ApplicationArgs []string
+	// PassEnv names host variables passed through with their current value
+	PassEnv []string
+}
+
+// ArgGroup is a group of related arguments of a shim. Only the host paths of
+// Expand groups, volumes and the working directory, may refer to host
+// variables such as $HOME, everything else is taken literally. Terminal
+// groups only apply if the shim runs with stdin and stdout on a terminal.
+type ArgGroup struct {
+	Args     []string
+	Expand   bool
+	Terminal bool
+}
+
+// ImageInfo is the subset of an image inspection please relies on.
+type ImageInfo struct {
+	ID           string
+	Digests      []string
+	Architecture string
+	OS           string
+	Size         int64
+}
+
+// Image is an entry of a runtime's local image store.
+type Image struct {
+	Repository string
+	Tag        string
+	ID         string
+}
+
+// Reference returns repository:tag, or the ID for untagged images.
+func (i Image) Reference() string {
+	if i.Repository == "" || i.Repository == "<none>" {
+		return i.ID
+	}
+	if i.Tag == "" || i.Tag == "<none>" {
+		return i.Repository
+	}
+	return i.Repository + ":" + i.Tag
+}
+
+// cliRuntime drives a runtime through its command line. docker, podman and
+// nerdctl share the docker CLI; Apple's container differs in the image
+// subcommands only.
+type cliRuntime struct {
+	name       string
+	path       string
+	removeArgs []string
+	listArgs   []string
+	// tailFlag limits the log output to the last lines
+	tailFlag string
+	// qualify expands short image names, podman refuses to guess a registry
+	qualify bool
+}
+
+var runtimes = map[string]func(path string) *cliRuntime{
+	"docker": func(path string) *cliRuntime {
+		return &cliRuntime{
+			name:       "docker",
+			path:       path,
+			removeArgs: []string{"image", "rm"},
+			tailFlag:   "--tail",
+			listArgs:   []string{"image", "ls", "--format", "{{json .}}"},
+		}
+	},
+	"podman": func(path string) *cliRuntime {
+		return &cliRuntime{
+			name:       "podman",
+			path:       path,
+			removeArgs: []string{"image", "rm"},
+			tailFlag:   "--tail",
+			listArgs:   []string{"image", "ls", "--format", "json"},
+			qualify:    true,
+		}
+	},
+	"nerdctl": func(path string) *cliRuntime {
+		return &cliRuntime{
+			name:       "nerdctl",
+			path:       path,
+			removeArgs: []string{"image", "rm"},
+			tailFlag:   "--tail",
+			listArgs:   []string{"image", "ls", "--format", "{{json .}}"},
+		}
+	},
+	"container": func(path string) *cliRuntime {
+		return &cliRuntime{
+			name:       "container",
+			path:       path,
+			removeArgs: []string{"image", "delete"},
+			tailFlag:   "-n",
+			listArgs:   []string{"image", "list", "--format", "json"},
+		}
+	},
+}
+
+// detectionOrder lists the runtimes tried, most preferred first.
+var detectionOrder = func() []string {
+	if runtime.GOOS == "darwin" {
+		return []string{"container", "docker", "podman", "nerdctl"}
+	}
+	return []string{"docker", "podman", "nerdctl", "container"}
+}()
+
+// RuntimeNames returns the names of the supported runtimes.
+func RuntimeNames() []string {
+	names := make([]string, 0, len(runtimes))
+	for name := range runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRuntime returns the named runtime. Without a name the one set in
+// $PLEASE_RUNTIME is used, otherwise the first runtime found on PATH.
+func NewRuntime(name string) (Runtime, error) {
+	if name == "" {
+		name = os.Getenv(RuntimeEnv)
+	}
+
+	if name != "" {
+		newRuntime, ok := runtimes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown container runtime %q, supported are %s", name, strings.Join(RuntimeNames(), ", "))
+		}
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover binary '%s'", name)
+		}
+		return newRuntime(path), nil
+	}
+
+	for _, candidate := range detectionOrder {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return runtimes[candidate](path), nil
+		}
+	}
+	return nil, fmt.Errorf("no container runtime found, install one of %s", strings.Join(detectionOrder, ", "))
+}
+
+// ImageReference returns image@digest if the digest is known and image:version
+// otherwise.
+func ImageReference(image, version, digest string) string {
+	if digest != "" {
+		return fmt.Sprintf("%s@%s", image, digest)
+	}
+	return fmt.Sprintf("%s:%s", image, version)
+}
+
+// NormalizeRepository strips the Docker Hub registry and library namespace
+// runtimes add to short names, so that alpine and docker.io/library/alpine
+// compare equal.
+func NormalizeRepository(repository string) string {
+	for _, prefix := range []string{"docker.io/", "index.docker.io/", "registry-1.docker.io/"} {
+		if strings.HasPrefix(repository, prefix) {
+			repository = strings.TrimPrefix(repository, prefix)
+			break
+		}
+	}
+	return strings.TrimPrefix(repository, "library/")
+}
+
+func (r *cliRuntime) Name() string {
+	return r.name
+}
+
+func (r *cliRuntime) Pull(ctx context.Context, reference, platform string) error {
+	args := []string{"image", "pull"}
+	if platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	args = append(args, r.reference(reference))
+
+	cmd := exec.CommandContext(ctx, r.path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+func (r *cliRuntime) RunArgs(opts RunOptions) []ArgGroup {
+	args := []ArgGroup{{Args: []string{"run", "-i", "--rm"}}}
+	switch opts.TTY {
+	case schema.TTYNever:
+	case schema.TTYAlways:
+		args = append(args, ArgGroup{Args: []string{"-t", "-e", "TERM"}})
+	default:
+		// Piping into or out of a shim has to keep working
+		args = append(args, ArgGroup{Args: []string{"-t", "-e", "TERM"}, Terminal: true})
+	}
+	for _, dns := range opts.DNS {
+		args = append(args, ArgGroup{Args: []string{"--dns", dns}})
+	}
+	for _, flag := range opts.AdditionalFlags {
+		args = append(args, ArgGroup{Args: []string{flag}})
+	}
+	for _, volume := range opts.Volumes {
+		args = append(args, ArgGroup{Args: []string{"--volume", volume}, Expand: true})
+	}
+	if opts.WorkDir != "" {
+		args = append(args, ArgGroup{Args: []string{"--workdir", opts.WorkDir}, Expand: true})
+	}
+	if opts.Platform != "" {
+		args = append(args, ArgGroup{Args: []string{"--platform", opts.Platform}})
+	}
+
+	keys := make([]string, 0, len(opts.ContainerEnvVars))
+	for key := range opts.ContainerEnvVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := opts.ContainerEnvVars[key]; value != "" {
+			args = append(args, ArgGroup{Args: []string{"-e", key + "=" + value}})
+		}
+	}
+	for _, name := range opts.PassEnv {
+		args = append(args, ArgGroup{Args: []string{"-e", name}})
+	}
+
+	args = append(args, ArgGroup{Args: []string{r.reference(opts.Reference)}})
+	if opts.Executable != "" {
+		args = append(args, ArgGroup{Args: []string{opts.Executable}})
+	}
+	for _, arg := range opts.ApplicationArgs {
+		args = append(args, ArgGroup{Args: []string{arg}})
+	}
+	return args
+}
+
+func (r *cliRuntime) Inspect(ctx context.Context, reference string) (*ImageInfo, error) {
+	out, err := r.output(ctx, "image", "inspect", r.reference(reference))
+	if err != nil {
+		return nil, err
+	}
+	return parseImageInspect(out)
+}
+
+func (r *cliRuntime) Remove(ctx context.Context, reference string) error {
+	args := append(append([]string{}, r.removeArgs...), r.reference(reference))
+	_, err := r.output(ctx, args...)
+	return err
+}
+
+func (r *cliRuntime) List(ctx context.Context) ([]Image, error) {
+	out, err := r.output(ctx, r.listArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return parseImageList(out)
+}
+
+func (r *cliRuntime) output(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.path, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w: %s", r.name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// reference qualifies short names such as alpine or bitnami/kubectl with
+// Docker Hub for runtimes that do not do so themselves.
+func (r *cliRuntime) reference(reference string) string {
+	if !r.qualify {
+		return reference
+	}
+	first, _, found := strings.Cut(reference, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return reference
+	}
+	if !found {
+		return "docker.io/library/" + reference
+	}
+	return "docker.io/" + reference
+}
+
+// parseImageInspect reads the JSON array image inspect prints. docker,
+// podman and nerdctl use the docker schema, Apple's container nests the
+// image's index and variants.
+func parseImageInspect(out []byte) (*ImageInfo, error) {
+	var images []map[string]any
+	if err := json.Unmarshal(out, &images); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal image inspection: %w", err)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("image not found")
+	}
+
+	image := images[0]
+	info := &ImageInfo{
+		ID:           stringField(image, "Id", "ID", "id"),
+		Architecture: stringField(image, "Architecture", "architecture"),
+		OS:           stringField(image, "Os", "OS", "os"),
+	}
+	if size, ok := image["Size"].(float64); ok {
+		info.Size = int64(size)
+	}
+	if digests, ok := image["RepoDigests"].([]any); ok {
+		for _, d := range digests {
+			if s, ok := d.(string); ok {
+				info.Digests = append(info.Digests, s)
+			}
+		}
+	}
+	if index, ok := image["index"].(map[string]any); ok {
+		if digest := stringField(index, "digest"); digest != "" {
+			info.Digests = append(info.Digests, digest)
+			if info.ID == "" {
+				info.ID = digest
+			}
+		}
+	}
+	return info, nil
+}
+
+// parseImageList reads image listings printed either as a JSON array
+// (podman, container) or as one JSON object per line (docker, nerdctl).
+func parseImageList(out []byte) ([]Image, error) {
+	var entries []map[string]any
+
+	trimmed := bytes.TrimSpace(out)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal image list: %w", err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal image list: %w", err)
+			}
+			entries = append(entries, entry)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var images []Image
+	for _, entry := range entries {
+		id := stringField(entry, "ID", "Id", "id")
+
+		// podman lists every name of an image, container a single reference
+		var names []string
+		if list, ok := entry["Names"].([]any); ok {
+			for _, n := range list {
+				if s, ok := n.(string); ok {
+					names = append(names, s)
+				}
+			}
+		} else if reference := stringField(entry, "reference"); reference != "" {
+			names = append(names, reference)
+		}
+
+		if len(names) == 0 {
+			images = append(images, Image{
+				Repository: stringField(entry, "Repository"),
+				Tag:        stringField(entry, "Tag"),
+				ID:         id,
+			})
+			continue
+		}
+		for _, name := range names {
+			repository, tag := splitReference(name)
+			images = append(images, Image{Repository: repository, Tag: tag, ID: id})
+		}
+	}
+	return images, nil
+}
+
+// splitReference splits repository:tag, leaving a registry port and digest
+// references intact.
+func splitReference(reference string) (repository, tag string) {
+	if strings.Contains(reference, "@") {
+		return reference, ""
+	}
+	i := strings.LastIndex(reference, ":")
+	if i < 0 || strings.Contains(reference[i:], "/") {
+		return reference, ""
+	}
+	return reference[:i], reference[i+1:]
+}
+
+func stringField(m map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := m[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func fakeBinaries(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	return dir
+}
+
+func TestNewRuntime(t *testing.T) {
+	t.Run("detects first available runtime", func(t *testing.T) {
+		fakeBinaries(t, "podman", "nerdctl")
+		t.Setenv(RuntimeEnv, "")
+
+		rt, err := NewRuntime("")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if rt.Name() != "podman" {
+			t.Errorf("expected podman, got %s", rt.Name())
+		}
+	})
+
+	t.Run("environment overrides detection", func(t *testing.T) {
+		fakeBinaries(t, "docker", "nerdctl")
+		t.Setenv(RuntimeEnv, "nerdctl")
+
+		rt, err := NewRuntime("")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if rt.Name() != "nerdctl" {
+			t.Errorf("expected nerdctl, got %s", rt.Name())
+		}
+	})
+
+	t.Run("configured runtime missing", func(t *testing.T) {
+		fakeBinaries(t, "docker")
+
+		if _, err := NewRuntime("podman"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("unknown runtime", func(t *testing.T) {
+		fakeBinaries(t, "docker")
+
+		if _, err := NewRuntime("lxc"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("no runtime installed", func(t *testing.T) {
+		fakeBinaries(t)
+		t.Setenv(RuntimeEnv, "")
+
+		if _, err := NewRuntime(""); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestRunArgs(t *testing.T) {
+	opts := RunOptions{
+		ContainerArgs: schema.ContainerArgs{
+			DNS:              []string{"1.1.1.1"},
+			Volumes:          []string{"$PWD:/work"},
+			WorkDir:          "/work",
+			ContainerEnvVars: map[string]string{"B": "2", "A": "1", "EMPTY": ""},
+		},
+		Reference:  "alpine/helm:3.14.0",
+		Platform:   "linux/arm64",
+		Executable: "helm",
+	}
+
+	t.Run("docker", func(t *testing.T) {
+		got := runtimes["docker"]("/usr/bin/docker").RunArgs(opts)
+		expected := []ArgGroup{
+			{Args: []string{"run", "-i", "--rm"}},
+			{Args: []string{"-t", "-e", "TERM"}, Terminal: true},
+			{Args: []string{"--dns", "1.1.1.1"}},
+			{Args: []string{"--volume", "$PWD:/work"}, Expand: true},
+			{Args: []string{"--workdir", "/work"}, Expand: true},
+			{Args: []string{"--platform", "linux/arm64"}},
+			{Args: []string{"-e", "A=1"}},
+			{Args: []string{"-e", "B=2"}},
+			{Args: []string{"alpine/helm:3.14.0"}},
+			{Args: []string{"helm"}},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("tty modes", func(t *testing.T) {
+		rt := runtimes["docker"]("/usr/bin/docker")
+		always := opts
+		always.TTY = schema.TTYAlways
+		if got := rt.RunArgs(always)[1]; !reflect.DeepEqual(got, ArgGroup{Args: []string{"-t", "-e", "TERM"}}) {
+			t.Errorf("expected an unconditional terminal, got %v", got)
+		}
+		never := opts
+		never.TTY = schema.TTYNever
+		if got := rt.RunArgs(never)[1]; got.Args[0] != "--dns" {
+			t.Errorf("expected no terminal, got %v", got)
+		}
+	})
+
+	t.Run("podman qualifies short names", func(t *testing.T) {
+		got := runtimes["podman"]("/usr/bin/podman").RunArgs(opts)
+		image := got[len(got)-2].Args[0]
+		if image != "docker.io/alpine/helm:3.14.0" {
+			t.Errorf("expected docker.io/alpine/helm:3.14.0, got %s", image)
+		}
+	})
+}
+
+func TestQualifyReference(t *testing.T) {
+	rt := runtimes["podman"]("/usr/bin/podman")
+	tests := map[string]string{
+		"alpine:3.19":                   "docker.io/library/alpine:3.19",
+		"bitnami/kubectl:1.29":          "docker.io/bitnami/kubectl:1.29",
+		"ghcr.io/org/tool:1.0":          "ghcr.io/org/tool:1.0",
+		"localhost/tool:dev":            "localhost/tool:dev",
+		"registry:5000/tool@sha256:abc": "registry:5000/tool@sha256:abc",
+	}
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			if got := rt.reference(input); got != expected {
+				t.Errorf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeRepository(t *testing.T) {
+	tests := map[string]string{
+		"alpine":                     "alpine",
+		"docker.io/library/alpine":   "alpine",
+		"docker.io/bitnami/kubectl":  "bitnami/kubectl",
+		"index.docker.io/library/jq": "jq",
+		"ghcr.io/org/tool":           "ghcr.io/org/tool",
+	}
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			if got := NormalizeRepository(input); got != expected {
+				t.Errorf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestParseImageList(t *testing.T) {
+	t.Run("json lines", func(t *testing.T) {
+		out := []byte(`{"Repository":"alpine/helm","Tag":"3.14.0","ID":"sha256:aaa"}
+{"Repository":"<none>","Tag":"<none>","ID":"sha256:bbb"}
+`)
+		images, err := parseImageList(out)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(images) != 2 {
+			t.Fatalf("expected 2 images, got %d", len(images))
+		}
+		if ref := images[0].Reference(); ref != "alpine/helm:3.14.0" {
+			t.Errorf("expected alpine/helm:3.14.0, got %s", ref)
+		}
+		if ref := images[1].Reference(); ref != "sha256:bbb" {
+			t.Errorf("expected sha256:bbb, got %s", ref)
+		}
+	})
+
+	t.Run("json array with names", func(t *testing.T) {
+		out := []byte(`[{"Id":"aaa","Names":["docker.io/alpine/helm:3.14.0","localhost:5000/helm:latest"]}]`)
+		images, err := parseImageList(out)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []Image{
+			{Repository: "docker.io/alpine/helm", Tag: "3.14.0", ID: "aaa"},
+			{Repository: "localhost:5000/helm", Tag: "latest", ID: "aaa"},
+		}
+		if !reflect.DeepEqual(images, expected) {
+			t.Errorf("expected %v, got %v", expected, images)
+		}
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		if _, err := parseImageList([]byte("not json")); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestParseImageInspect(t *testing.T) {
+	out := []byte(`[{"Id":"sha256:aaa","RepoDigests":["alpine/helm@sha256:ccc"],"Architecture":"arm64","Os":"linux","Size":1024}]`)
+	info, err := parseImageInspect(out)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := &ImageInfo{
+		ID:           "sha256:aaa",
+		Digests:      []string{"alpine/helm@sha256:ccc"},
+		Architecture: "arm64",
+		OS:           "linux",
+		Size:         1024,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
@@ -0,0 +1,197 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arafat/please/schema"
+	"github.com/arafat/please/utils"
+)
+
+// ErrNoSuchContainer is returned for a service container that does not exist.
+var ErrNoSuchContainer = errors.New("no such container")
+
+// ServiceOptions describes the detached container of a service package.
+type ServiceOptions struct {
+	schema.ContainerArgs
+	Service         schema.ServiceArgs
+	Name            string
+	Labels          map[string]string
+	Reference       string
+	Platform        string
+	Executable      string
+	ApplicationArgs []string
+}
+
+// ContainerStatus is the state of a service container.
+type ContainerStatus struct {
+	// State is the runtime's state, e.g. running or exited.
+	State string
+	// Health is healthy, unhealthy or starting, or empty without health check.
+	Health  string
+	Started time.Time
+}
+
+// Running reports whether the container is up.
+func (s *ContainerStatus) Running() bool {
+	return s.State == "running"
+}
+
+func (r *cliRuntime) Start(ctx context.Context, opts ServiceOptions) error {
+	_, err := r.output(ctx, r.serviceArgs(opts)...)
+	return err
+}
+
+// serviceArgs renders the command line starting a service container.
+func (r *cliRuntime) serviceArgs(opts ServiceOptions) []string {
+	args := []string{"run", "--detach", "--name", opts.Name}
+
+	keys := make([]string, 0, len(opts.Labels))
+	for key := range opts.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--label", key+"="+opts.Labels[key])
+	}
+
+	if opts.Service.Restart != "" {
+		args = append(args, "--restart", opts.Service.Restart)
+	}
+	for _, port := range opts.Service.Ports {
+		args = append(args, "--publish", port)
+	}
+	for _, volume := range opts.Service.Volumes {
+		args = append(args, "--volume", volume)
+	}
+	if hc := opts.Service.HealthCheck; hc != nil {
+		args = append(args, "--health-cmd", hc.Command)
+		if hc.Interval != "" {
+			args = append(args, "--health-interval", hc.Interval)
+		}
+		if hc.Timeout != "" {
+			args = append(args, "--health-timeout", hc.Timeout)
+		}
+		if hc.Retries > 0 {
+			args = append(args, "--health-retries", strconv.Itoa(hc.Retries))
+		}
+	}
+
+	// There is no shell to expand the host paths as in shims, e.g. $HOME
+	for _, dns := range opts.DNS {
+		args = append(args, "--dns", dns)
+	}
+	args = append(args, opts.AdditionalFlags...)
+	for _, volume := range opts.Volumes {
+		args = append(args, "--volume", expandHostPath(volume))
+	}
+	if opts.WorkDir != "" {
+		args = append(args, "--workdir", expandHostPath(opts.WorkDir))
+	}
+	if opts.Platform != "" {
+		args = append(args, "--platform", opts.Platform)
+	}
+
+	keys = keys[:0]
+	for key := range opts.ContainerEnvVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := opts.ContainerEnvVars[key]; value != "" {
+			args = append(args, "--env", key+"="+value)
+		}
+	}
+
+	args = append(args, r.reference(opts.Reference))
+	if opts.Executable != "" {
+		args = append(args, opts.Executable)
+	}
+	return append(args, opts.ApplicationArgs...)
+}
+
+// expandHostPath expands the host variables of a path like a shim does.
+func expandHostPath(path string) string {
+	return utils.ExpandHostVars(path, os.Getenv, func(text string) string { return text })
+}
+
+// Stop stops and removes a service container, named volumes are kept.
+func (r *cliRuntime) Stop(ctx context.Context, name string) error {
+	if _, err := r.output(ctx, "stop", name); err != nil {
+		return noSuchContainer(err)
+	}
+	if _, err := r.output(ctx, "rm", name); err != nil {
+		return noSuchContainer(err)
+	}
+	return nil
+}
+
+func (r *cliRuntime) Status(ctx context.Context, name string) (*ContainerStatus, error) {
+	out, err := r.output(ctx, "inspect", name)
+	if err != nil {
+		return nil, noSuchContainer(err)
+	}
+	return parseContainerInspect(out)
+}
+
+// Logs copies the output of a service container to stdout and stderr. With
+// follow it keeps doing so until the container stops or ctx is done; tail
+// limits the output to the last lines if positive.
+func (r *cliRuntime) Logs(ctx context.Context, name string, follow bool, tail int) error {
+	args := []string{"logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	if tail > 0 {
+		args = append(args, r.tailFlag, strconv.Itoa(tail))
+	}
+	args = append(args, name)
+
+	cmd := exec.CommandContext(ctx, r.path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// noSuchContainer maps the runtimes' messages for unknown containers to
+// ErrNoSuchContainer.
+func noSuchContainer(err error) error {
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "no such container") || strings.Contains(msg, "not found") {
+		return fmt.Errorf("%w: %v", ErrNoSuchContainer, err)
+	}
+	return err
+}
+
+// parseContainerInspect reads the JSON array container inspect prints,
+// State.Status in the docker schema or status in that of Apple's container.
+func parseContainerInspect(out []byte) (*ContainerStatus, error) {
+	var containers []map[string]any
+	if err := json.Unmarshal(out, &containers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal container inspection: %w", err)
+	}
+	if len(containers) == 0 {
+		return nil, ErrNoSuchContainer
+	}
+
+	c := containers[0]
+	status := &ContainerStatus{State: stringField(c, "status")}
+	if state, ok := c["State"].(map[string]any); ok {
+		status.State = stringField(state, "Status")
+		if health, ok := state["Health"].(map[string]any); ok {
+			status.Health = stringField(health, "Status")
+		}
+		if started, err := time.Parse(time.RFC3339Nano, stringField(state, "StartedAt")); err == nil {
+			status.Started = started
+		}
+	}
+	return status, nil
+}
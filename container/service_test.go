@@ -0,0 +1,107 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestServiceArgs(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+
+	opts := ServiceOptions{
+		ContainerArgs: schema.ContainerArgs{
+			Volumes:          []string{"$HOME/init:/docker-entrypoint-initdb.d", "~/backup:/backup"},
+			WorkDir:          "${HOME}",
+			ContainerEnvVars: map[string]string{"POSTGRES_PASSWORD": "$ecret", "EMPTY": ""},
+		},
+		Service: schema.ServiceArgs{
+			Ports:       []string{"5432:5432"},
+			Volumes:     []string{"please-dev-postgres-data:/var/lib/postgresql/data"},
+			HealthCheck: &schema.HealthCheck{Command: "pg_isready", Interval: "5s", Retries: 3},
+			Restart:     "unless-stopped",
+		},
+		Name:      "please-dev-postgres",
+		Labels:    map[string]string{"please.package": "postgres", "please.bundle": "dev"},
+		Reference: "postgres:16",
+		Platform:  "linux/arm64",
+	}
+
+	got := runtimes["podman"]("/usr/bin/podman").serviceArgs(opts)
+	expected := []string{
+		"run", "--detach", "--name", "please-dev-postgres",
+		"--label", "please.bundle=dev",
+		"--label", "please.package=postgres",
+		"--restart", "unless-stopped",
+		"--publish", "5432:5432",
+		"--volume", "please-dev-postgres-data:/var/lib/postgresql/data",
+		"--health-cmd", "pg_isready",
+		"--health-interval", "5s",
+		"--health-retries", "3",
+		"--volume", "/home/me/init:/docker-entrypoint-initdb.d",
+		"--volume", "/home/me/backup:/backup",
+		"--workdir", "/home/me",
+		"--platform", "linux/arm64",
+		"--env", "POSTGRES_PASSWORD=$ecret",
+		"docker.io/library/postgres:16",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestParseContainerInspect(t *testing.T) {
+	t.Run("docker", func(t *testing.T) {
+		out := []byte(`[{"Id":"abc","State":{"Status":"running","StartedAt":"2024-05-01T10:00:00.5Z","Health":{"Status":"healthy"}}}]`)
+		status, err := parseContainerInspect(out)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := &ContainerStatus{
+			State:   "running",
+			Health:  "healthy",
+			Started: time.Date(2024, 5, 1, 10, 0, 0, 500000000, time.UTC),
+		}
+		if !reflect.DeepEqual(status, expected) {
+			t.Errorf("expected %+v, got %+v", expected, status)
+		}
+		if !status.Running() {
+			t.Error("expected the container to be running")
+		}
+	})
+
+	t.Run("container", func(t *testing.T) {
+		status, err := parseContainerInspect([]byte(`[{"status":"stopped","configuration":{"id":"please-dev-redis"}}]`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status.State != "stopped" || status.Running() {
+			t.Errorf("expected stopped, got %+v", status)
+		}
+	})
+
+	t.Run("no container", func(t *testing.T) {
+		if _, err := parseContainerInspect([]byte(`[]`)); !errors.Is(err, ErrNoSuchContainer) {
+			t.Errorf("expected ErrNoSuchContainer, got %v", err)
+		}
+	})
+}
+
+func TestNoSuchContainer(t *testing.T) {
+	for _, msg := range []string{
+		"Error response from daemon: No such container: please-dev-redis",
+		"Error: no container with name or ID \"please-dev-redis\" found: no such container",
+		"container not found: please-dev-redis",
+	} {
+		if err := noSuchContainer(fmt.Errorf("%s", msg)); !errors.Is(err, ErrNoSuchContainer) {
+			t.Errorf("%s: expected ErrNoSuchContainer, got %v", msg, err)
+		}
+	}
+	if err := noSuchContainer(errors.New("permission denied")); errors.Is(err, ErrNoSuchContainer) {
+		t.Error("expected other errors to be kept")
+	}
+}
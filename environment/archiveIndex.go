@@ -0,0 +1,370 @@
+package environment
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arafat/please/schema"
+)
+
+const (
+	indexVersion = 1
+	indexDir     = "index"
+	stampSuffix  = ".stamp"
+)
+
+// indexEntry locates a raw manifest in the data file of an archive index.
+type indexEntry struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// archiveIndex is the persisted lookup table of a manifest archive. It is
+// stored as <checksum>.idx next to <checksum>.dat, which holds the raw
+// manifests, so a changed archive never matches a stale index.
+type archiveIndex struct {
+	Version   int                     `json:"version"`
+	Checksum  string                  `json:"checksum"`
+	Namespace string                  `json:"namespace"`
+	Names     []string                `json:"names"`
+	Manifests map[string]indexEntry   `json:"manifests"`
+	Hooks     map[string]*ScriptHooks `json:"hooks"`
+
+	dataPath string
+}
+
+func indexPaths(archivePath, checksum string) (idxPath, dataPath string) {
+	dir := filepath.Join(filepath.Dir(archivePath), indexDir)
+	return filepath.Join(dir, checksum+".idx"), filepath.Join(dir, checksum+".dat")
+}
+
+func archiveChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to checksum tarball: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveStamp remembers the checksum of an archive together with its size
+// and modification time, so that opening an unchanged archive does not hash
+// it again.
+type archiveStamp struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	Checksum string    `json:"checksum"`
+}
+
+func stampPath(archivePath string) string {
+	return filepath.Join(filepath.Dir(archivePath), indexDir, filepath.Base(archivePath)+stampSuffix)
+}
+
+// stampedChecksum returns the checksum of the archive at path, hashing it only
+// if its size or modification time differ from the recorded stamp.
+func stampedChecksum(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open tarball: %w", err)
+	}
+
+	var stamp archiveStamp
+	if data, err := os.ReadFile(stampPath(path)); err == nil && json.Unmarshal(data, &stamp) == nil {
+		if stamp.Checksum != "" && stamp.Size == info.Size() && stamp.ModTime.Equal(info.ModTime()) {
+			return stamp.Checksum, nil
+		}
+	}
+
+	checksum, err := archiveChecksum(path)
+	if err != nil {
+		return "", err
+	}
+	writeStamp(path, info, checksum)
+	return checksum, nil
+}
+
+// writeStamp records checksum for the archive described by info. Without a
+// stamp the archive is only hashed again, so failures are ignored.
+func writeStamp(path string, info os.FileInfo, checksum string) {
+	data, err := json.Marshal(archiveStamp{Size: info.Size(), ModTime: info.ModTime(), Checksum: checksum})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(stampPath(path)), 0755); err != nil {
+		return
+	}
+	writeFileAtomic(stampPath(path), data, 0644)
+}
+
+// loadOrBuildIndex returns the index of the archive at path, rebuilding it if
+// it is missing, stale or corrupt.
+func loadOrBuildIndex(path string) (*archiveIndex, error) {
+	checksum, err := stampedChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx, err := loadIndex(path, checksum); err == nil {
+		return idx, nil
+	}
+	return buildIndex(path, checksum)
+}
+
+func loadIndex(archivePath, checksum string) (*archiveIndex, error) {
+	idxPath, dataPath := indexPaths(archivePath, checksum)
+
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var idx archiveIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("corrupt index %s: %w", idxPath, err)
+	}
+	if idx.Version != indexVersion || idx.Checksum != checksum {
+		return nil, fmt.Errorf("stale index %s", idxPath)
+	}
+
+	stat, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	for name, entry := range idx.Manifests {
+		if entry.Offset < 0 || entry.Length <= 0 || entry.Offset+entry.Length > stat.Size() {
+			return nil, fmt.Errorf("corrupt index %s: entry %q out of range", idxPath, name)
+		}
+	}
+
+	idx.dataPath = dataPath
+	return &idx, nil
+}
+
+// buildIndex streams the archive once for its manifests and once for its
+// hooks and writes the index atomically.
+func buildIndex(archivePath, checksum string) (*archiveIndex, error) {
+	idxPath, dataPath := indexPaths(archivePath, checksum)
+	if err := os.MkdirAll(filepath.Dir(idxPath), 0755); err != nil {
+		return nil, fmt.Errorf("Error creating directories:%w", err)
+	}
+
+	idx := &archiveIndex{
+		Version:   indexVersion,
+		Checksum:  checksum,
+		Manifests: make(map[string]indexEntry),
+		Hooks:     make(map[string]*ScriptHooks),
+		dataPath:  dataPath,
+	}
+
+	manifestDecoder, err := NewManifestDecoder(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer manifestDecoder.Close()
+	idx.Namespace = manifestDecoder.namespace
+
+	dataTmp := dataPath + ".tmp"
+	out, err := os.Create(dataTmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index data: %w", err)
+	}
+	defer os.Remove(dataTmp)
+
+	var offset int64
+	for manifestDecoder.decoder.More() {
+		var raw json.RawMessage
+		if err := manifestDecoder.decoder.Decode(&raw); err != nil {
+			out.Close()
+			return nil, fmt.Errorf("failed to decode object: %w", err)
+		}
+
+		var pm schema.PackageManifest
+		if err := json.Unmarshal(raw, &pm); err != nil {
+			out.Close()
+			return nil, fmt.Errorf("failed to decode object: %w", err)
+		}
+
+		if _, err := out.Write(raw); err != nil {
+			out.Close()
+			return nil, fmt.Errorf("failed to write index data: %w", err)
+		}
+
+		if _, exists := idx.Manifests[pm.Name]; !exists {
+			idx.Names = append(idx.Names, pm.Name)
+			idx.Manifests[pm.Name] = indexEntry{Offset: offset, Length: int64(len(raw))}
+		}
+		offset += int64(len(raw))
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write index data: %w", err)
+	}
+
+	if err := indexHooks(archivePath, idx); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal index: %w", err)
+	}
+
+	idxTmp := idxPath + ".tmp"
+	if err := os.WriteFile(idxTmp, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write index: %w", err)
+	}
+	defer os.Remove(idxTmp)
+
+	if err := os.Rename(dataTmp, dataPath); err != nil {
+		return nil, fmt.Errorf("failed to write index data: %w", err)
+	}
+	if err := os.Rename(idxTmp, idxPath); err != nil {
+		return nil, fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return idx, nil
+}
+
+// indexHooks collects the install and cleanup scripts of every package.
+func indexHooks(archivePath string, idx *archiveIndex) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg || !strings.HasPrefix(header.Name, "hooks/") {
+			continue
+		}
+
+		fileName := strings.TrimPrefix(header.Name, "hooks/")
+		var pkg string
+		var isPreHook bool
+		switch {
+		case strings.HasSuffix(fileName, "_install.sh"):
+			pkg, isPreHook = strings.TrimSuffix(fileName, "_install.sh"), true
+		case strings.HasSuffix(fileName, "_cleanup.sh"):
+			pkg = strings.TrimSuffix(fileName, "_cleanup.sh")
+		default:
+			continue
+		}
+
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read hook script %s: %w", fileName, err)
+		}
+
+		hooks := idx.Hooks[pkg]
+		if hooks == nil {
+			hooks = &ScriptHooks{}
+			idx.Hooks[pkg] = hooks
+		}
+		if isPreHook {
+			hooks.PreHook = string(contents)
+		} else {
+			hooks.PostHook = string(contents)
+		}
+	}
+}
+
+// manifest reads the raw manifest of name from the data file.
+func (idx *archiveIndex) manifest(name string) (*schema.PackageManifest, error) {
+	entry, ok := idx.Manifests[name]
+	if !ok {
+		return nil, fmt.Errorf("package with name '%s' not found", name)
+	}
+
+	f, err := os.Open(idx.dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index data: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, entry.Length)
+	if _, err := f.ReadAt(buf, entry.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read index data: %w", err)
+	}
+
+	var pm schema.PackageManifest
+	if err := json.Unmarshal(buf, &pm); err != nil {
+		return nil, fmt.Errorf("corrupt index data for %q: %w", name, err)
+	}
+	return &pm, nil
+}
+
+// RebuildManifestIndexes rebuilds the index of every manifest archive and
+// removes indexes that no longer belong to any archive.
+func (e *Environment) RebuildManifestIndexes() error {
+	paths, err := e.GetManifestPaths()
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool)
+	var errs []error
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		checksum, err := archiveChecksum(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := buildIndex(path, checksum); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), err))
+			continue
+		}
+		writeStamp(path, info, checksum)
+		keep[checksum] = true
+		keep[filepath.Base(path)+stampSuffix] = true
+	}
+
+	entries, err := os.ReadDir(filepath.Join(e.manifestPath, indexDir))
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] {
+			continue
+		}
+		checksum := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".idx"), ".dat")
+		if !keep[checksum] {
+			os.Remove(filepath.Join(e.manifestPath, indexDir, entry.Name()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,257 @@
+package environment
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arafat/please/utils/semver"
+)
+
+// versionRegexp matches image tags, which are a single path segment in the
+// versions directory.
+var versionRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// packageNameRegexp matches package names, which are a single path segment in
+// the versions directory.
+var packageNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidatePackageName returns an error if name cannot be a package of the
+// versions directory.
+func ValidatePackageName(name string) error {
+	if !packageNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid package name %q", name)
+	}
+	return nil
+}
+
+// ValidateVersion returns an error if version cannot be installed, for
+// versions that are not checked against a manifest's list.
+func ValidateVersion(version string) error {
+	if !versionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	return nil
+}
+
+// InstalledArtifacts lists the package versions in the versions directory,
+// sorted by package and newest version first.
+func (e *Environment) InstalledArtifacts() ([]Artifact, error) {
+	pkgs, err := os.ReadDir(e.VersionsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read versions directory: %w", err)
+	}
+
+	var artifacts []Artifact
+	for _, pkg := range pkgs {
+		if !pkg.IsDir() {
+			continue
+		}
+		versions, err := os.ReadDir(filepath.Join(e.VersionsPath, pkg.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read versions directory: %w", err)
+		}
+		for _, version := range versions {
+			if version.IsDir() {
+				artifacts = append(artifacts, Artifact{pkg.Name(), version.Name()})
+			}
+		}
+	}
+
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		if artifacts[i].Package != artifacts[j].Package {
+			return artifacts[i].Package < artifacts[j].Package
+		}
+		return semver.Compare(artifacts[i].Version, artifacts[j].Version) > 0
+	})
+	return artifacts, nil
+}
+
+// ReferencedArtifacts returns the package versions used by any bundle,
+// linked into the bin directory of a project, run by a started service or
+// being deployed by an unfinished operation.
+func (e *Environment) ReferencedArtifacts(b *Bundle) (map[Artifact]bool, error) {
+	referenced := make(map[Artifact]bool)
+
+	// A running command deploys its versions before the bundle definitions
+	// name them, its journal does from the start
+	ops, err := e.journals()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		for _, a := range op.Created {
+			referenced[a] = true
+		}
+	}
+
+	for _, bundle := range b.bDefs.Bundles {
+		for pkg, version := range bundle.Packages {
+			referenced[Artifact{pkg, version}] = true
+		}
+		for pkg, versions := range bundle.Versions {
+			for _, version := range versions {
+				referenced[Artifact{pkg, version}] = true
+			}
+		}
+	}
+
+	projects, err := e.projectArtifacts()
+	if err != nil {
+		return nil, err
+	}
+	for a := range projects {
+		referenced[a] = true
+	}
+
+	services, err := LoadServices(e)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services.List("") {
+		referenced[Artifact{svc.Package, svc.Version}] = true
+	}
+	return referenced, nil
+}
+
+// ArtifactReferences returns what keeps an installed version alive: the
+// bundles using it by name, followed by one "project" entry for every project
+// linking it and one "service" entry for every started service running it.
+func (e *Environment) ArtifactReferences(b *Bundle, a Artifact) ([]string, error) {
+	references := b.BundlesUsing(a.Package, a.Version)
+
+	projects, err := e.projectArtifacts()
+	if err != nil {
+		return nil, err
+	}
+	for range projects[a] {
+		references = append(references, "project")
+	}
+
+	services, err := LoadServices(e)
+	if err != nil {
+		return nil, err
+	}
+	for range services.Using(a.Package, a.Version) {
+		references = append(references, "service")
+	}
+	return references, nil
+}
+
+// projectArtifacts counts the project bin directories linking each version.
+// Project files can live anywhere, their bin directories tell which versions
+// they use.
+func (e *Environment) projectArtifacts() (map[Artifact]int, error) {
+	links, err := filepath.Glob(filepath.Join(e.PleasePath, projectsDir, "*", "bin", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	type use struct {
+		project string
+		a       Artifact
+	}
+	seen := make(map[use]bool)
+	counts := make(map[Artifact]int)
+	versionsPath := filepath.Clean(e.VersionsPath) + string(filepath.Separator)
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil || !strings.HasPrefix(target, versionsPath) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(target, versionsPath), string(filepath.Separator))
+		if len(parts) != 3 {
+			continue
+		}
+		// A package with several executables counts once per project
+		u := use{filepath.Dir(filepath.Dir(link)), Artifact{parts[0], parts[1]}}
+		if !seen[u] {
+			seen[u] = true
+			counts[u.a]++
+		}
+	}
+	return counts, nil
+}
+
+// UnreferencedArtifacts returns the installed versions no bundle or project
+// uses. The keep newest unreferenced versions of each package are spared.
+func (e *Environment) UnreferencedArtifacts(b *Bundle, keep int) ([]Artifact, error) {
+	installed, err := e.InstalledArtifacts()
+	if err != nil {
+		return nil, err
+	}
+	referenced, err := e.ReferencedArtifacts(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var unreferenced []Artifact
+	kept := make(map[string]int)
+	for _, a := range installed {
+		if referenced[a] {
+			continue
+		}
+		if kept[a.Package] < keep {
+			kept[a.Package]++
+			continue
+		}
+		unreferenced = append(unreferenced, a)
+	}
+	return unreferenced, nil
+}
+
+// ArtifactSize returns the disk space used by an installed version.
+func (e *Environment) ArtifactSize(a Artifact) int64 {
+	var size int64
+	filepath.WalkDir(filepath.Join(e.VersionsPath, a.Package, a.Version), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// imageFile records the image reference an installed version was pulled as.
+const imageFile = "image"
+
+// RecordImage records that pkg:version was installed from the image
+// reference, so that gc only ever removes images please pulled itself.
+func (e *Environment) RecordImage(pkg, version, reference string) error {
+	path := filepath.Join(e.VersionsPath, pkg, version, imageFile)
+	if err := os.WriteFile(path, []byte(reference+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record image: %w", err)
+	}
+	return nil
+}
+
+// ArtifactImage returns the image reference recorded for an installed
+// version, empty for versions installed before references were recorded.
+func (e *Environment) ArtifactImage(a Artifact) string {
+	data, err := os.ReadFile(filepath.Join(e.VersionsPath, a.Package, a.Version, imageFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// RemoveArtifact deletes an installed version and the package directory once
+// its last version is gone.
+func (e *Environment) RemoveArtifact(a Artifact) error {
+	if err := e.DeleteArtifact(a.Package, a.Version); err != nil {
+		return err
+	}
+	// Fails while other versions remain
+	os.Remove(filepath.Join(e.VersionsPath, a.Package))
+	return nil
+}
@@ -0,0 +1,163 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestUnreferencedArtifacts(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:      tmpDir,
+		VersionsPath:    filepath.Join(tmpDir, "versions"),
+		EnvironmentPath: filepath.Join(tmpDir, "env.json"),
+	}
+
+	for _, a := range []Artifact{
+		{"kubectl", "1.27.0"}, {"kubectl", "1.28.0"}, {"kubectl", "1.29.0"}, {"kubectl", "1.30.0"},
+		{"jq", "1.6"}, {"jq", "1.7"},
+	} {
+		installed := filepath.Join(e.VersionsPath, a.Package, a.Version)
+		if err := os.MkdirAll(installed, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installed, a.Package+".sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	data, _ := json.Marshal(&schema.BundleDefinitions{
+		ActiveBundle: "default",
+		Bundles: map[string]*schema.Bundle{
+			"default": {Packages: map[string]string{"kubectl": "1.28.0"}},
+			"ops":     {Packages: map[string]string{"kubectl": "1.30.0"}},
+		},
+	})
+	if err := os.WriteFile(e.EnvironmentPath, data, 0644); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	b, err := LoadBundleDefinitions(e)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// A project outside of env.json uses jq 1.6
+	project := &schema.Bundle{Packages: map[string]string{"jq": "1.6"}}
+	if _, _, _, err := e.LinkProject(filepath.Join(tmpDir, "project", ProjectFileName), project); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	tests := []struct {
+		keep     int
+		expected []Artifact
+	}{
+		{0, []Artifact{{"jq", "1.7"}, {"kubectl", "1.29.0"}, {"kubectl", "1.27.0"}}},
+		{1, []Artifact{{"kubectl", "1.27.0"}}},
+		{2, nil},
+	}
+	for _, tt := range tests {
+		got, err := e.UnreferencedArtifacts(b, tt.keep)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(got) != len(tt.expected) {
+			t.Fatalf("keep %d: expected %v, got %v", tt.keep, tt.expected, got)
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("keep %d: expected %v, got %v", tt.keep, tt.expected, got)
+			}
+		}
+	}
+
+	t.Run("versions being deployed are referenced", func(t *testing.T) {
+		op, err := e.BeginOperation("install", "default")
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		defer op.Finish()
+		if err := op.Creates("kubectl", "1.31.0"); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Join(e.VersionsPath, "kubectl", "1.31.0"), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		got, err := e.UnreferencedArtifacts(b, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if slices.Contains(got, Artifact{"kubectl", "1.31.0"}) {
+			t.Errorf("expected kubectl:1.31.0 to be kept, got %v", got)
+		}
+	})
+
+	t.Run("references name bundles and projects", func(t *testing.T) {
+		b.AddPackage("ops", "jq", "1.6")
+		tests := map[Artifact][]string{
+			{"kubectl", "1.28.0"}: {"default"},
+			{"jq", "1.6"}:         {"ops", "project"},
+			{"jq", "1.7"}:         nil,
+		}
+		for a, expected := range tests {
+			got, err := e.ArtifactReferences(b, a)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !slices.Equal(got, expected) {
+				t.Errorf("%s: expected %v, got %v", a, expected, got)
+			}
+		}
+	})
+
+	t.Run("removing the last version removes the package", func(t *testing.T) {
+		if err := e.RemoveArtifact(Artifact{"jq", "1.7"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := e.RemoveArtifact(Artifact{"jq", "1.6"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(e.VersionsPath, "jq")); !os.IsNotExist(err) {
+			t.Errorf("expected jq directory to be removed, got %v", err)
+		}
+	})
+}
+
+func TestArtifactImage(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{VersionsPath: filepath.Join(tmpDir, "versions")}
+	for _, version := range []string{"1.7", "1.6"} {
+		if err := os.MkdirAll(filepath.Join(e.VersionsPath, "jq", version), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	if err := e.RecordImage("jq", "1.7", "ghcr.io/jqlang/jq@sha256:abc"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ref := e.ArtifactImage(Artifact{"jq", "1.7"}); ref != "ghcr.io/jqlang/jq@sha256:abc" {
+		t.Errorf("expected ghcr.io/jqlang/jq@sha256:abc, got %q", ref)
+	}
+	// Installed before references were recorded
+	if ref := e.ArtifactImage(Artifact{"jq", "1.6"}); ref != "" {
+		t.Errorf("expected no reference, got %q", ref)
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	for _, version := range []string{"1.7", "20.9-bookworm", "latest", "_build"} {
+		if err := ValidateVersion(version); err != nil {
+			t.Errorf("%q: expected no error, got %v", version, err)
+		}
+	}
+	for _, version := range []string{"", ".", "..", "../jq", "1.7/bin", "-rf"} {
+		if err := ValidateVersion(version); err == nil {
+			t.Errorf("%q: expected error, got nil", version)
+		}
+	}
+}
@@ -3,13 +3,33 @@ package environment
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/arafat/please/schema"
 )
 
+// bundleNameRegexp matches names that are a single path segment, bundle
+// names become directories and temporary file patterns.
+var bundleNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidateBundleName returns an error if name cannot be used as a bundle name.
+func ValidateBundleName(name string) error {
+	if !bundleNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid bundle name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
 type Bundle struct {
 	bDefs *schema.BundleDefinitions
+	// session is the bundle of the please shell the command runs in, it takes
+	// precedence over the globally active bundle
+	session string
 }
 
 func LoadBundleDefinitions(s *Environment) (*Bundle, error) {
@@ -23,7 +43,14 @@ func LoadBundleDefinitions(s *Environment) (*Bundle, error) {
 		return nil, fmt.Errorf("failed to unmarshal bundle definitions: %w", err)
 	}
 
-	return &Bundle{bDefs: &bDefs}, nil
+	b := &Bundle{bDefs: &bDefs}
+	if err := b.checkExtends(); err != nil {
+		return nil, fmt.Errorf("invalid bundle definitions: %w", err)
+	}
+	if s.SessionBundle != "" && b.BundleExists(s.SessionBundle) {
+		b.session = s.SessionBundle
+	}
+	return b, nil
 }
 
 func (b *Bundle) SaveBundle(e *Environment) error {
@@ -32,7 +59,9 @@ func (b *Bundle) SaveBundle(e *Environment) error {
 		return fmt.Errorf("failed to marshal bundle definitions: %w", err)
 	}
 
-	err = os.WriteFile(e.EnvironmentPath, data, 0644)
+	// Commands commit their changes by saving the bundle definitions, a crash
+	// must not leave a truncated file behind
+	err = writeFileAtomic(e.EnvironmentPath, data, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
@@ -41,21 +70,7 @@ func (b *Bundle) SaveBundle(e *Environment) error {
 }
 
 func (b *Bundle) IsPackageInstalled(bundleName, packageName, version string) bool {
-	env, ok := b.bDefs.Bundles[bundleName]
-	if !ok {
-		return false
-	}
-
-	if env.Packages == nil {
-		return false
-	}
-
-	installedVersion, ok := env.Packages[packageName]
-	if !ok {
-		return false
-	}
-
-	return installedVersion == version
+	return slices.Contains(b.GetPackageVersions(bundleName, packageName), version)
 }
 
 func (b *Bundle) AddPackage(bundleName, packageName, version string) error {
@@ -71,12 +86,22 @@ func (b *Bundle) AddPackage(bundleName, packageName, version string) error {
 		env.Packages = make(map[string]string)
 	}
 
+	if previous, ok := env.Packages[packageName]; ok && previous != version {
+		delete(env.Lock, lockKey(packageName, previous))
+	}
 	env.Packages[packageName] = version
+	// A version installed next to the previous default becomes the default
+	if others, ok := env.Versions[packageName]; ok {
+		env.Versions[packageName] = slices.DeleteFunc(others, func(v string) bool { return v == version })
+		if len(env.Versions[packageName]) == 0 {
+			delete(env.Versions, packageName)
+		}
+	}
 	return nil
 }
 
 func (b *Bundle) DeletePackage(packageName string) error {
-	bundleName := b.bDefs.ActiveBundle
+	bundleName := b.GetActiveBundle()
 	env, ok := b.bDefs.Bundles[bundleName]
 
 	if !ok {
@@ -87,7 +112,20 @@ func (b *Bundle) DeletePackage(packageName string) error {
 		return fmt.Errorf("bundle %q has no packages", bundleName)
 	}
 
+	if _, ok := env.Packages[packageName]; !ok {
+		if inherited, ok := b.ResolvePackages(bundleName)[packageName]; ok {
+			return fmt.Errorf("package %q is inherited from bundle %q", packageName, inherited.Bundle)
+		}
+	}
+
+	if version, ok := env.Packages[packageName]; ok {
+		delete(env.Lock, lockKey(packageName, version))
+	}
+	for _, version := range env.Versions[packageName] {
+		delete(env.Lock, lockKey(packageName, version))
+	}
 	delete(env.Packages, packageName)
+	delete(env.Versions, packageName)
 	return nil
 }
 
@@ -102,25 +140,45 @@ func (b *Bundle) SetActiveBundle(bundleName string) error {
 	return fmt.Errorf("bundle %q does not exist", bundleName)
 }
 
+// GetActiveBundle returns the bundle commands operate on: the bundle of the
+// surrounding please shell or else the globally active one.
 func (b *Bundle) GetActiveBundle() string {
+	if b.session != "" {
+		return b.session
+	}
+	return b.bDefs.ActiveBundle
+}
+
+// GetDefaultBundle returns the globally active bundle linked into ~/.please/bin.
+func (b *Bundle) GetDefaultBundle() string {
 	return b.bDefs.ActiveBundle
 }
 
+// InSession reports whether the command runs inside a please shell.
+func (b *Bundle) InSession() bool {
+	return b.session != ""
+}
+
 func (b *Bundle) BundleExists(bundleName string) bool {
 	_, exists := b.bDefs.Bundles[bundleName]
 	return exists
 }
 
+// ListBundles returns the names of all bundles, sorted.
 func (b *Bundle) ListBundles() []string {
 	names := make([]string, 0, len(b.bDefs.Bundles))
 	for name, _ := range b.bDefs.Bundles {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 
 	return names
 }
 
 func (b *Bundle) AddBundle(bundleName, description string) error {
+	if err := ValidateBundleName(bundleName); err != nil {
+		return err
+	}
 	for name, _ := range b.bDefs.Bundles {
 		if name == bundleName {
 			return fmt.Errorf("bundle %q already exists", bundleName)
@@ -136,29 +194,271 @@ func (b *Bundle) AddBundle(bundleName, description string) error {
 }
 
 func (b *Bundle) GetPackageVersion(pkg string) (string, error) {
-	activeBundle := b.bDefs.ActiveBundle
-	bundle, _ := b.bDefs.Bundles[activeBundle]
-	version, ok := bundle.Packages[pkg]
+	activeBundle := b.GetActiveBundle()
+	resolved, ok := b.ResolvePackages(activeBundle)[pkg]
 	if !ok {
 		return "", fmt.Errorf("package %q does not exist in bundle %q", pkg, activeBundle)
 	}
 
-	return version, nil
+	return resolved.Version, nil
 }
 
+// GetInstalledPackages returns the packages of bundleName including those it
+// inherits, mapped to their versions.
 func (b *Bundle) GetInstalledPackages(bundleName string) map[string]string {
-	bundle, _ := b.bDefs.Bundles[bundleName]
-	return bundle.Packages
+	packages := make(map[string]string)
+	for pkg, resolved := range b.ResolvePackages(bundleName) {
+		packages[pkg] = resolved.Version
+	}
+	return packages
 }
 
 func (b *Bundle) DeleteBundle(bundleName string) error {
-	if bundleName == b.GetActiveBundle() {
+	if bundleName == b.GetActiveBundle() || bundleName == b.GetDefaultBundle() {
 		return fmt.Errorf("bundle %q is active", bundleName)
 	}
 	if ok := b.BundleExists(bundleName); !ok {
 		return fmt.Errorf("bundle %q does not exist", bundleName)
 	}
+	if children := b.ExtendedBy(bundleName); len(children) > 0 {
+		return fmt.Errorf("bundle %q is extended by %s", bundleName, strings.Join(children, ", "))
+	}
 
 	delete(b.bDefs.Bundles, bundleName)
 	return nil
 }
+
+func lockKey(pkg, version string) string {
+	return fmt.Sprintf("%s:%s", pkg, version)
+}
+
+// getLock returns the lock of pkg:version recorded in bundleName or, for an
+// inherited package, in the bundle declaring it.
+func (b *Bundle) getLock(bundleName, pkg, version string) *schema.PackageLock {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	if !ok {
+		return nil
+	}
+	if lock := bundle.Lock[lockKey(pkg, version)]; lock != nil {
+		return lock
+	}
+
+	resolved, ok := b.ResolvePackages(bundleName)[pkg]
+	if !ok || resolved.Bundle == bundleName || !slices.Contains(b.GetPackageVersions(bundleName, pkg), version) {
+		return nil
+	}
+	return b.bDefs.Bundles[resolved.Bundle].Lock[lockKey(pkg, version)]
+}
+
+func (b *Bundle) ensureLock(bundleName, pkg, version string) (*schema.PackageLock, error) {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	if !ok {
+		return nil, fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+
+	if bundle.Lock == nil {
+		bundle.Lock = make(map[string]*schema.PackageLock)
+	}
+
+	key := lockKey(pkg, version)
+	if bundle.Lock[key] == nil {
+		bundle.Lock[key] = &schema.PackageLock{}
+	}
+	return bundle.Lock[key], nil
+}
+
+// GetPackageDigest returns the digest pinned for pkg:version in the bundle or
+// an empty string if the version is not pinned.
+func (b *Bundle) GetPackageDigest(bundleName, pkg, version string) string {
+	if lock := b.getLock(bundleName, pkg, version); lock != nil {
+		return lock.Digest
+	}
+	return ""
+}
+
+// SetPackageDigest pins pkg:version in the bundle to digest.
+func (b *Bundle) SetPackageDigest(bundleName, pkg, version, digest string) error {
+	lock, err := b.ensureLock(bundleName, pkg, version)
+	if err != nil {
+		return err
+	}
+	lock.Digest = digest
+	return nil
+}
+
+// GetPackageNamespace returns the manifest namespace pkg:version was installed
+// from or an empty string if it was not recorded.
+func (b *Bundle) GetPackageNamespace(bundleName, pkg, version string) string {
+	if lock := b.getLock(bundleName, pkg, version); lock != nil {
+		return lock.Namespace
+	}
+	return ""
+}
+
+// SetPackageNamespace records the manifest namespace pkg:version was installed
+// from.
+func (b *Bundle) SetPackageNamespace(bundleName, pkg, version, namespace string) error {
+	lock, err := b.ensureLock(bundleName, pkg, version)
+	if err != nil {
+		return err
+	}
+	lock.Namespace = namespace
+	return nil
+}
+
+// GetPackageConstraint returns the version constraint pkg:version was
+// installed with or an empty string if the version is pinned.
+func (b *Bundle) GetPackageConstraint(bundleName, pkg, version string) string {
+	if lock := b.getLock(bundleName, pkg, version); lock != nil {
+		return lock.Constraint
+	}
+	return ""
+}
+
+// SetPackageConstraint records the version constraint pkg:version was
+// installed with. An empty constraint pins the version.
+func (b *Bundle) SetPackageConstraint(bundleName, pkg, version, constraint string) error {
+	lock, err := b.ensureLock(bundleName, pkg, version)
+	if err != nil {
+		return err
+	}
+	lock.Constraint = constraint
+	return nil
+}
+
+// BundlesUsing returns the sorted names of the bundles that contain
+// pkg:version, inherited or not.
+func (b *Bundle) BundlesUsing(pkg, version string) []string {
+	var names []string
+	for name := range b.bDefs.Bundles {
+		if b.IsPackageInstalled(name, pkg, version) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetDescription returns the description of bundleName.
+func (b *Bundle) GetDescription(bundleName string) string {
+	if bundle, ok := b.bDefs.Bundles[bundleName]; ok {
+		return bundle.Description
+	}
+	return ""
+}
+
+// SetDescription replaces the description of bundleName.
+func (b *Bundle) SetDescription(bundleName, description string) error {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	if !ok {
+		return fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+	bundle.Description = description
+	return nil
+}
+
+// CloneBundle creates dst with the description, packages and pins of src.
+func (b *Bundle) CloneBundle(src, dst string) error {
+	source, ok := b.bDefs.Bundles[src]
+	if !ok {
+		return fmt.Errorf("bundle %q does not exist", src)
+	}
+	if err := ValidateBundleName(dst); err != nil {
+		return err
+	}
+	if b.BundleExists(dst) {
+		return fmt.Errorf("bundle %q already exists", dst)
+	}
+
+	clone := &schema.Bundle{
+		Description: source.Description,
+		Extends:     slices.Clone(source.Extends),
+		Packages:    maps.Clone(source.Packages),
+	}
+	if source.Versions != nil {
+		clone.Versions = make(map[string][]string, len(source.Versions))
+		for pkg, versions := range source.Versions {
+			clone.Versions[pkg] = slices.Clone(versions)
+		}
+	}
+	if clone.Packages == nil {
+		clone.Packages = make(map[string]string)
+	}
+	if source.Lock != nil {
+		clone.Lock = make(map[string]*schema.PackageLock, len(source.Lock))
+		for key, lock := range source.Lock {
+			copied := *lock
+			clone.Lock[key] = &copied
+		}
+	}
+	b.bDefs.Bundles[dst] = clone
+	return nil
+}
+
+// RenameBundle renames a bundle and keeps it active if it was. The bundle of
+// the surrounding please shell cannot be renamed, the shell refers to it by
+// name.
+func (b *Bundle) RenameBundle(oldName, newName string) error {
+	bundle, ok := b.bDefs.Bundles[oldName]
+	if !ok {
+		return fmt.Errorf("bundle %q does not exist", oldName)
+	}
+	if err := ValidateBundleName(newName); err != nil {
+		return err
+	}
+	if b.BundleExists(newName) {
+		return fmt.Errorf("bundle %q already exists", newName)
+	}
+	if oldName == b.session {
+		return fmt.Errorf("bundle %q is used by the surrounding please shell", oldName)
+	}
+
+	for _, child := range b.ExtendedBy(oldName) {
+		extends := b.bDefs.Bundles[child].Extends
+		extends[slices.Index(extends, oldName)] = newName
+	}
+	b.bDefs.Bundles[newName] = bundle
+	delete(b.bDefs.Bundles, oldName)
+	if b.bDefs.ActiveBundle == oldName {
+		b.bDefs.ActiveBundle = newName
+	}
+	return nil
+}
+
+// PackageChange is a difference between two bundles. From and To list the
+// versions of the package in either bundle, the default one first. From is
+// empty for a package only the second bundle has, To for one only the first
+// has.
+type PackageChange struct {
+	Package string
+	From    []string
+	To      []string
+}
+
+// DiffBundles returns the packages added, removed or changed in their
+// versions going from one bundle to the other, sorted by package.
+func (b *Bundle) DiffBundles(from, to string) ([]PackageChange, error) {
+	for _, name := range []string{from, to} {
+		if !b.BundleExists(name) {
+			return nil, fmt.Errorf("bundle %q does not exist", name)
+		}
+	}
+	fromPkgs := b.GetAllPackageVersions(from)
+	toPkgs := b.GetAllPackageVersions(to)
+
+	names := make(map[string]bool)
+	for pkg := range fromPkgs {
+		names[pkg] = true
+	}
+	for pkg := range toPkgs {
+		names[pkg] = true
+	}
+
+	var changes []PackageChange
+	for _, pkg := range slices.Sorted(maps.Keys(names)) {
+		if !slices.Equal(fromPkgs[pkg], toPkgs[pkg]) {
+			changes = append(changes, PackageChange{pkg, fromPkgs[pkg], toPkgs[pkg]})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,139 @@
+package environment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	bundlesDir     = "bundles"
+	generationsDir = "generations"
+)
+
+// BundleBinPath returns the bin directory please shell puts on PATH for
+// bundleName.
+func (e *Environment) BundleBinPath(bundleName string) string {
+	return filepath.Join(e.PleasePath, bundlesDir, bundleName, "bin")
+}
+
+// LinkBundle (re)creates the bin directory of bundleName from the bundle's
+// packages, swapping it like ActivateBundle so please shells using it never
+// see a partial directory. Packages whose version is not installed are returned as
+// "pkg:version" in missing, entries that were not linked for another reason
+// are described in skipped.
+func (e *Environment) LinkBundle(b *Bundle, bundleName string) (binPath string, missing, skipped []string, err error) {
+	if !b.BundleExists(bundleName) {
+		return "", nil, nil, fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+
+	binPath = e.BundleBinPath(bundleName)
+	missing, skipped, err = e.linkGeneration(binPath, bundleName+"-", b.GetAllPackageVersions(bundleName))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return binPath, missing, skipped, nil
+}
+
+// RemoveBundleBin deletes the bin directory of a deleted bundle and the
+// generation it links to.
+func (e *Environment) RemoveBundleBin(bundleName string) error {
+	binPath := e.BundleBinPath(bundleName)
+	if generation, err := os.Readlink(binPath); err == nil && filepath.Dir(generation) == filepath.Join(e.PleasePath, generationsDir) {
+		if err := os.RemoveAll(generation); err != nil {
+			return fmt.Errorf("Error removing bundle bin directory:%w", err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(e.PleasePath, bundlesDir, bundleName)); err != nil {
+		return fmt.Errorf("Error removing bundle directory:%w", err)
+	}
+	return nil
+}
+
+// ActivateBundle makes bundleName the content of the global bin directory.
+// A failure leaves the previous bundle linked as it was. Packages whose
+// version is not installed are returned as "pkg:version" in missing, entries
+// that were not linked for another reason are described in skipped.
+func (e *Environment) ActivateBundle(b *Bundle, bundleName string) (missing, skipped []string, err error) {
+	if !b.BundleExists(bundleName) {
+		return nil, nil, fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+	return e.linkGeneration(e.BinPath, bundleName+"-", b.GetAllPackageVersions(bundleName))
+}
+
+// linkGeneration links packages in a fresh directory of the generations
+// directory, named after prefix, and swaps binPath to it with a single rename
+// of the bin symlink, so readers of binPath never see a partial directory.
+func (e *Environment) linkGeneration(binPath, prefix string, packages map[string][]string) (missing, skipped []string, err error) {
+	generations := filepath.Join(e.PleasePath, generationsDir)
+	if err := os.MkdirAll(generations, 0755); err != nil {
+		return nil, nil, fmt.Errorf("Error creating directories:%w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		return nil, nil, fmt.Errorf("Error creating directories:%w", err)
+	}
+	generation, err := os.MkdirTemp(generations, prefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating bin directory:%w", err)
+	}
+	if err := os.Chmod(generation, 0755); err != nil {
+		os.RemoveAll(generation)
+		return nil, nil, fmt.Errorf("Error creating bin directory:%w", err)
+	}
+
+	missing, skipped, err = e.linkPackages(generation, packages)
+	if err != nil {
+		os.RemoveAll(generation)
+		return nil, nil, err
+	}
+
+	previous, err := switchBin(binPath, generation)
+	if err != nil {
+		os.RemoveAll(generation)
+		return nil, nil, err
+	}
+	// Only directories please created itself are removed
+	if previous == binPath+".old" || filepath.Dir(previous) == generations {
+		os.RemoveAll(previous)
+	}
+	return missing, skipped, nil
+}
+
+// switchBin points binPath at generation and returns what it replaced so the
+// caller can remove it. A bin directory created before linking was atomic is
+// a plain directory; it is moved aside first and restored if the switch fails.
+func switchBin(binPath, generation string) (previous string, err error) {
+	link := binPath + ".new"
+	os.Remove(link)
+	if err := os.Symlink(generation, link); err != nil {
+		return "", fmt.Errorf("failed to create symlink in %s: %w", link, err)
+	}
+
+	info, err := os.Lstat(binPath)
+	switch {
+	case err == nil && info.Mode()&os.ModeSymlink != 0:
+		if previous, err = os.Readlink(binPath); err != nil {
+			os.Remove(link)
+			return "", fmt.Errorf("Error reading bin symlink:%w", err)
+		}
+	case err == nil:
+		previous = binPath + ".old"
+		os.RemoveAll(previous)
+		if err := os.Rename(binPath, previous); err != nil {
+			os.Remove(link)
+			return "", fmt.Errorf("Error moving bin directory aside:%w", err)
+		}
+	case !os.IsNotExist(err):
+		os.Remove(link)
+		return "", fmt.Errorf("Error reading bin directory:%w", err)
+	}
+
+	if err := os.Rename(link, binPath); err != nil {
+		os.Remove(link)
+		if previous == binPath+".old" {
+			os.Rename(previous, binPath)
+		}
+		return "", fmt.Errorf("Error switching bin directory:%w", err)
+	}
+	return previous, nil
+}
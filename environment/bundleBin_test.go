@@ -0,0 +1,247 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestLinkBundle(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:      tmpDir,
+		VersionsPath:    filepath.Join(tmpDir, "versions"),
+		EnvironmentPath: filepath.Join(tmpDir, "env.json"),
+		SessionBundle:   "dev",
+	}
+
+	for _, version := range []string{"1.28.0", "1.29.0"} {
+		installed := filepath.Join(e.VersionsPath, "kubectl", version)
+		if err := os.MkdirAll(installed, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installed, "kubectl.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	data, _ := json.Marshal(&schema.BundleDefinitions{
+		ActiveBundle: "default",
+		Bundles: map[string]*schema.Bundle{
+			"default": {Packages: map[string]string{"kubectl": "1.28.0"}},
+			"dev":     {Packages: map[string]string{"kubectl": "1.29.0"}},
+		},
+	})
+	if err := os.WriteFile(e.EnvironmentPath, data, 0644); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	b, err := LoadBundleDefinitions(e)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	t.Run("session bundle is active", func(t *testing.T) {
+		if active := b.GetActiveBundle(); active != "dev" {
+			t.Errorf("expected dev, got %s", active)
+		}
+		if def := b.GetDefaultBundle(); def != "default" {
+			t.Errorf("expected default, got %s", def)
+		}
+		if err := b.DeleteBundle("dev"); err == nil {
+			t.Error("expected the session bundle to be protected from deletion")
+		}
+	})
+
+	t.Run("bundles get separate bin directories", func(t *testing.T) {
+		for bundleName, version := range map[string]string{"default": "1.28.0", "dev": "1.29.0"} {
+			binPath, missing, _, err := e.LinkBundle(b, bundleName)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(missing) != 0 {
+				t.Errorf("expected nothing missing, got %v", missing)
+			}
+			if binPath != e.BundleBinPath(bundleName) {
+				t.Errorf("expected %s, got %s", e.BundleBinPath(bundleName), binPath)
+			}
+
+			target, err := os.Readlink(filepath.Join(binPath, "kubectl"))
+			if err != nil {
+				t.Fatalf("expected kubectl symlink, got %v", err)
+			}
+			expected := filepath.Join(e.VersionsPath, "kubectl", version, "kubectl.sh")
+			if target != expected {
+				t.Errorf("expected %s, got %s", expected, target)
+			}
+		}
+	})
+
+	t.Run("relinking swaps the bin directory", func(t *testing.T) {
+		if _, _, _, err := e.LinkBundle(b, "dev"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		generation, err := os.Readlink(e.BundleBinPath("dev"))
+		if err != nil {
+			t.Fatalf("expected bin symlink, got %v", err)
+		}
+
+		if _, _, _, err := e.LinkBundle(b, "dev"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := os.Stat(generation); !os.IsNotExist(err) {
+			t.Errorf("expected previous generation to be removed, got %v", err)
+		}
+
+		generation, _ = os.Readlink(e.BundleBinPath("dev"))
+		if err := e.RemoveBundleBin("dev"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := os.Stat(generation); !os.IsNotExist(err) {
+			t.Errorf("expected generation to be removed with the bundle, got %v", err)
+		}
+	})
+
+	t.Run("unknown bundle", func(t *testing.T) {
+		if _, _, _, err := e.LinkBundle(b, "prod"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestActivateBundle(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:      tmpDir,
+		BinPath:         filepath.Join(tmpDir, "bin"),
+		VersionsPath:    filepath.Join(tmpDir, "versions"),
+		EnvironmentPath: filepath.Join(tmpDir, "env.json"),
+	}
+
+	install := func(pkg, version, executable string) {
+		installed := filepath.Join(e.VersionsPath, pkg, version)
+		if err := os.MkdirAll(installed, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installed, executable+".sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	install("kubectl", "1.28.0", "kubectl")
+	install("kubectl", "1.29.0", "kubectl")
+	install("kubectl-fork", "1.0.0", "kubectl")
+
+	// A bin directory as created by please init
+	if err := os.MkdirAll(e.BinPath, 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	data, _ := json.Marshal(&schema.BundleDefinitions{
+		ActiveBundle: "default",
+		Bundles: map[string]*schema.Bundle{
+			"default": {Packages: map[string]string{"kubectl": "1.28.0"}},
+			"dev":     {Packages: map[string]string{"kubectl": "1.29.0", "helm": "3.14.0"}},
+			"broken":  {Packages: map[string]string{"kubectl": "1.28.0", "kubectl-fork": "1.0.0"}},
+		},
+	})
+	if err := os.WriteFile(e.EnvironmentPath, data, 0644); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	b, err := LoadBundleDefinitions(e)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	linked := func(t *testing.T) string {
+		t.Helper()
+		target, err := os.Readlink(filepath.Join(e.BinPath, "kubectl"))
+		if err != nil {
+			t.Fatalf("expected kubectl symlink, got %v", err)
+		}
+		return target
+	}
+
+	t.Run("plain bin directory is replaced", func(t *testing.T) {
+		missing, _, err := e.ActivateBundle(b, "default")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(missing) != 0 {
+			t.Errorf("expected nothing missing, got %v", missing)
+		}
+		if info, err := os.Lstat(e.BinPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("expected bin to be a symlink, got %v", err)
+		}
+		expected := filepath.Join(e.VersionsPath, "kubectl", "1.28.0", "kubectl.sh")
+		if target := linked(t); target != expected {
+			t.Errorf("expected %s, got %s", expected, target)
+		}
+	})
+
+	t.Run("switch removes the previous generation", func(t *testing.T) {
+		previous, _ := os.Readlink(e.BinPath)
+
+		missing, _, err := e.ActivateBundle(b, "dev")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(missing) != 1 || missing[0] != "helm:3.14.0" {
+			t.Errorf("expected [helm:3.14.0], got %v", missing)
+		}
+		expected := filepath.Join(e.VersionsPath, "kubectl", "1.29.0", "kubectl.sh")
+		if target := linked(t); target != expected {
+			t.Errorf("expected %s, got %s", expected, target)
+		}
+		if _, err := os.Stat(previous); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", previous, err)
+		}
+	})
+
+	t.Run("failure keeps the previous bundle", func(t *testing.T) {
+		current, _ := os.Readlink(e.BinPath)
+
+		// A directory in the way of the new bin symlink
+		blocked := filepath.Join(e.BinPath+".new", "file")
+		if err := os.MkdirAll(blocked, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		defer os.RemoveAll(e.BinPath + ".new")
+
+		if _, _, err := e.ActivateBundle(b, "default"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if target, _ := os.Readlink(e.BinPath); target != current {
+			t.Errorf("expected bin to still point to %s, got %s", current, target)
+		}
+		expected := filepath.Join(e.VersionsPath, "kubectl", "1.29.0", "kubectl.sh")
+		if target := linked(t); target != expected {
+			t.Errorf("expected %s, got %s", expected, target)
+		}
+
+		entries, _ := os.ReadDir(filepath.Join(tmpDir, generationsDir))
+		if len(entries) != 1 {
+			t.Errorf("expected only the active generation to remain, got %d", len(entries))
+		}
+	})
+
+	t.Run("conflicting executables keep the first package", func(t *testing.T) {
+		_, skipped, err := e.ActivateBundle(b, "broken")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(skipped) != 1 {
+			t.Errorf("expected the kubectl of kubectl-fork to be skipped, got %v", skipped)
+		}
+		expected := filepath.Join(e.VersionsPath, "kubectl", "1.28.0", "kubectl.sh")
+		if target := linked(t); target != expected {
+			t.Errorf("expected %s, got %s", expected, target)
+		}
+		if _, err := os.Lstat(filepath.Join(e.BinPath, "kubectl@1.0.0")); err != nil {
+			t.Errorf("expected kubectl@1.0.0 of kubectl-fork, got %v", err)
+		}
+	})
+}
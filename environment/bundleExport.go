@@ -0,0 +1,130 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/arafat/please/schema"
+)
+
+// ExportBundle describes bundleName as a document that can be imported on
+// another machine.
+func (b *Bundle) ExportBundle(bundleName string) (*schema.BundleExport, error) {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	if !ok {
+		return nil, fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+
+	doc := &schema.BundleExport{
+		Format:      schema.BundleExportFormat,
+		Name:        bundleName,
+		Description: bundle.Description,
+		Packages:    []schema.ExportedPackage{},
+	}
+	// The export is self-contained, inherited packages are flattened into it
+	packages := b.GetAllPackageVersions(bundleName)
+	for _, pkg := range slices.Sorted(maps.Keys(packages)) {
+		for i, version := range packages[pkg] {
+			exported := schema.ExportedPackage{Name: pkg, Version: version, Default: i == 0}
+			if lock := b.getLock(bundleName, pkg, version); lock != nil {
+				exported.Namespace = lock.Namespace
+				exported.Digest = lock.Digest
+				exported.Constraint = lock.Constraint
+			}
+			doc.Packages = append(doc.Packages, exported)
+		}
+	}
+	return doc, nil
+}
+
+// ReadBundleExport decodes and checks an exported bundle.
+func ReadBundleExport(r io.Reader) (*schema.BundleExport, error) {
+	var doc schema.BundleExport
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bundle export: %w", err)
+	}
+
+	switch {
+	case doc.Format == 0:
+		return nil, fmt.Errorf("not a bundle export, the format version is missing")
+	case doc.Format > schema.BundleExportFormat:
+		return nil, fmt.Errorf("bundle export format %d is newer than the supported format %d, upgrade please", doc.Format, schema.BundleExportFormat)
+	case doc.Name == "":
+		return nil, fmt.Errorf("bundle export has no name")
+	}
+	if err := ValidateBundleName(doc.Name); err != nil {
+		return nil, fmt.Errorf("bundle export: %w", err)
+	}
+
+	// Format 1 lists the default version of every package only
+	if doc.Format == 1 {
+		for i := range doc.Packages {
+			doc.Packages[i].Default = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	defaults := make(map[string]int)
+	for _, pkg := range doc.Packages {
+		if pkg.Name == "" || pkg.Version == "" {
+			return nil, fmt.Errorf("bundle export lists a package without name or version")
+		}
+		if seen[lockKey(pkg.Name, pkg.Version)] {
+			return nil, fmt.Errorf("bundle export lists %s:%s twice", pkg.Name, pkg.Version)
+		}
+		seen[lockKey(pkg.Name, pkg.Version)] = true
+		if _, ok := defaults[pkg.Name]; !ok {
+			defaults[pkg.Name] = 0
+		}
+		if pkg.Default {
+			defaults[pkg.Name]++
+		}
+	}
+	for _, pkg := range slices.Sorted(maps.Keys(defaults)) {
+		if defaults[pkg] != 1 {
+			return nil, fmt.Errorf("bundle export has to mark exactly one version of %q as default, got %d", pkg, defaults[pkg])
+		}
+	}
+	return &doc, nil
+}
+
+// ImportBundle creates bundleName from an exported bundle.
+func (b *Bundle) ImportBundle(doc *schema.BundleExport, bundleName string) error {
+	if err := b.AddBundle(bundleName, doc.Description); err != nil {
+		return err
+	}
+
+	// The default versions go first, the others are added next to them
+	packages := slices.Clone(doc.Packages)
+	slices.SortStableFunc(packages, func(a, b schema.ExportedPackage) int {
+		switch {
+		case a.Default == b.Default:
+			return 0
+		case a.Default:
+			return -1
+		default:
+			return 1
+		}
+	})
+	for _, pkg := range packages {
+		if err := b.AddPackageVersion(bundleName, pkg.Name, pkg.Version); err != nil {
+			delete(b.bDefs.Bundles, bundleName)
+			return err
+		}
+		if pkg.Namespace != "" {
+			b.SetPackageNamespace(bundleName, pkg.Name, pkg.Version, pkg.Namespace)
+		}
+		if pkg.Digest != "" {
+			b.SetPackageDigest(bundleName, pkg.Name, pkg.Version, pkg.Digest)
+		}
+		if pkg.Constraint != "" {
+			b.SetPackageConstraint(bundleName, pkg.Name, pkg.Version, pkg.Constraint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package environment
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestExportImportBundle(t *testing.T) {
+	b := &Bundle{bDefs: &schema.BundleDefinitions{
+		ActiveBundle: "default",
+		Bundles: map[string]*schema.Bundle{
+			"default": {Packages: map[string]string{}},
+			"ops": {
+				Description: "Cluster tooling",
+				Packages:    map[string]string{"kubectl": "1.29.0", "jq": "1.7"},
+				Versions:    map[string][]string{"kubectl": {"1.28.4"}},
+				Lock: map[string]*schema.PackageLock{
+					"kubectl:1.29.0": {Namespace: "core", Digest: "sha256:abc", Constraint: "^1.29"},
+					"kubectl:1.28.4": {Digest: "sha256:def"},
+				},
+			},
+		},
+	}}
+
+	doc, err := b.ExportBundle("ops")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if doc.Format != schema.BundleExportFormat {
+		t.Errorf("expected format %d, got %d", schema.BundleExportFormat, doc.Format)
+	}
+	if len(doc.Packages) != 3 || doc.Packages[0].Name != "jq" {
+		t.Fatalf("expected jq and both versions of kubectl sorted, got %v", doc.Packages)
+	}
+	if pkg := doc.Packages[2]; pkg.Version != "1.28.4" || pkg.Default || pkg.Digest != "sha256:def" {
+		t.Errorf("expected kubectl 1.28.4 next to the default, got %+v", pkg)
+	}
+
+	data, _ := json.Marshal(doc)
+	read, err := ReadBundleExport(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.ImportBundle(read, "ops-copy"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if b.bDefs.Bundles["ops-copy"].Description != "Cluster tooling" {
+		t.Errorf("expected description to be imported, got %q", b.bDefs.Bundles["ops-copy"].Description)
+	}
+	if versions := b.GetPackageVersions("ops-copy", "kubectl"); !slices.Equal(versions, []string{"1.29.0", "1.28.4"}) {
+		t.Errorf("expected kubectl 1.29.0 and 1.28.4, got %v", versions)
+	}
+	if d := b.GetPackageDigest("ops-copy", "kubectl", "1.28.4"); d != "sha256:def" {
+		t.Errorf("expected sha256:def, got %s", d)
+	}
+	if d := b.GetPackageDigest("ops-copy", "kubectl", "1.29.0"); d != "sha256:abc" {
+		t.Errorf("expected sha256:abc, got %s", d)
+	}
+	if c := b.GetPackageConstraint("ops-copy", "kubectl", "1.29.0"); c != "^1.29" {
+		t.Errorf("expected ^1.29, got %s", c)
+	}
+
+	t.Run("existing bundle", func(t *testing.T) {
+		if err := b.ImportBundle(read, "ops"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("format 1", func(t *testing.T) {
+		read, err := ReadBundleExport(strings.NewReader(`{"format": 1, "name": "old", "packages": [{"name": "jq", "version": "1.6"}]}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := b.ImportBundle(read, "old"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if v := b.GetInstalledPackages("old")["jq"]; v != "1.6" {
+			t.Errorf("expected jq 1.6, got %s", v)
+		}
+	})
+}
+
+func TestReadBundleExport(t *testing.T) {
+	invalid := map[string]string{
+		"not json":        `kubectl: 1.29.0`,
+		"missing format":  `{"name": "ops", "packages": []}`,
+		"newer format":    `{"format": 99, "name": "ops", "packages": []}`,
+		"missing name":    `{"format": 1, "packages": []}`,
+		"path as name":    `{"format": 1, "name": "../ops", "packages": []}`,
+		"unknown field":   `{"format": 1, "name": "ops", "packages": [], "extends": "base"}`,
+		"missing version": `{"format": 1, "name": "ops", "packages": [{"name": "jq"}]}`,
+		"duplicate":       `{"format": 2, "name": "ops", "packages": [{"name": "jq", "version": "1.6", "default": true}, {"name": "jq", "version": "1.6"}]}`,
+		"two defaults":    `{"format": 1, "name": "ops", "packages": [{"name": "jq", "version": "1.6"}, {"name": "jq", "version": "1.7"}]}`,
+		"no default":      `{"format": 2, "name": "ops", "packages": [{"name": "jq", "version": "1.6"}]}`,
+	}
+	for name, doc := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ReadBundleExport(strings.NewReader(doc)); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package environment
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ResolvedPackage is a package of a bundle's resolved view together with the
+// bundle that declares it.
+type ResolvedPackage struct {
+	Version string
+	Bundle  string
+}
+
+// ResolvePackages merges the packages of bundleName with those of the bundles
+// it extends. The bundle's own packages win over inherited ones and later
+// parents over earlier ones.
+func (b *Bundle) ResolvePackages(bundleName string) map[string]ResolvedPackage {
+	resolved := make(map[string]ResolvedPackage)
+	b.resolveInto(resolved, bundleName, make(map[string]bool))
+	return resolved
+}
+
+func (b *Bundle) resolveInto(resolved map[string]ResolvedPackage, bundleName string, visiting map[string]bool) {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	// Cycles are rejected when loading, this only guards against recursing
+	// forever on definitions edited in memory
+	if !ok || visiting[bundleName] {
+		return
+	}
+	visiting[bundleName] = true
+	defer delete(visiting, bundleName)
+
+	for _, parent := range bundle.Extends {
+		b.resolveInto(resolved, parent, visiting)
+	}
+	for pkg, version := range bundle.Packages {
+		resolved[pkg] = ResolvedPackage{version, bundleName}
+	}
+}
+
+// GetExtends returns the bundles bundleName extends.
+func (b *Bundle) GetExtends(bundleName string) []string {
+	if bundle, ok := b.bDefs.Bundles[bundleName]; ok {
+		return bundle.Extends
+	}
+	return nil
+}
+
+// SetExtends makes bundleName extend parents, which have to exist and must
+// not extend bundleName themselves.
+func (b *Bundle) SetExtends(bundleName string, parents []string) error {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	if !ok {
+		return fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+
+	previous := bundle.Extends
+	bundle.Extends = parents
+	if err := b.checkExtends(); err != nil {
+		bundle.Extends = previous
+		return err
+	}
+	return nil
+}
+
+// ExtendedBy returns the sorted names of the bundles directly extending
+// bundleName.
+func (b *Bundle) ExtendedBy(bundleName string) []string {
+	var children []string
+	for name, bundle := range b.bDefs.Bundles {
+		if slices.Contains(bundle.Extends, bundleName) {
+			children = append(children, name)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// checkExtends verifies that every extended bundle exists and that no bundle
+// extends itself, directly or through others.
+func (b *Bundle) checkExtends() error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[string]int)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("bundles extend each other in a cycle: %s", strings.Join(append(path, name), " → "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, parent := range b.bDefs.Bundles[name].Extends {
+			if !b.BundleExists(parent) {
+				return fmt.Errorf("bundle %q extends unknown bundle %q", name, parent)
+			}
+			if err := visit(parent, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+
+	for _, name := range b.ListBundles() {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func newExtendingBundles() *Bundle {
+	return &Bundle{bDefs: &schema.BundleDefinitions{
+		ActiveBundle: "platform",
+		Bundles: map[string]*schema.Bundle{
+			"base": {
+				Packages: map[string]string{"git": "2.43", "jq": "1.6", "yq": "4.40"},
+				Lock:     map[string]*schema.PackageLock{"jq:1.6": {Digest: "sha256:base"}},
+			},
+			"k8s": {Packages: map[string]string{"kubectl": "1.29.0", "yq": "4.42"}},
+			"platform": {
+				Extends:  []string{"base", "k8s"},
+				Packages: map[string]string{"jq": "1.7", "terraform": "1.7.0"},
+			},
+		},
+	}}
+}
+
+func TestResolvePackages(t *testing.T) {
+	b := newExtendingBundles()
+
+	expected := map[string]ResolvedPackage{
+		"git":       {"2.43", "base"},
+		"jq":        {"1.7", "platform"},
+		"yq":        {"4.42", "k8s"},
+		"kubectl":   {"1.29.0", "k8s"},
+		"terraform": {"1.7.0", "platform"},
+	}
+	resolved := b.ResolvePackages("platform")
+	if len(resolved) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, resolved)
+	}
+	for pkg, want := range expected {
+		if got := resolved[pkg]; got != want {
+			t.Errorf("%s: expected %v, got %v", pkg, want, got)
+		}
+	}
+
+	t.Run("inherited packages are installed", func(t *testing.T) {
+		if !b.IsPackageInstalled("platform", "git", "2.43") {
+			t.Error("expected git 2.43 to be installed in platform")
+		}
+		if v, _ := b.GetPackageVersion("kubectl"); v != "1.29.0" {
+			t.Errorf("expected 1.29.0, got %s", v)
+		}
+		if err := b.DeletePackage("git"); err == nil {
+			t.Error("expected error deleting an inherited package, got nil")
+		}
+	})
+
+	t.Run("locks of inherited packages", func(t *testing.T) {
+		// Without the override jq comes from base again
+		b.DeletePackage("jq")
+		if d := b.GetPackageDigest("platform", "jq", "1.6"); d != "sha256:base" {
+			t.Errorf("expected sha256:base, got %q", d)
+		}
+	})
+
+	t.Run("parents in use cannot be deleted", func(t *testing.T) {
+		b.SetActiveBundle("base")
+		if err := b.DeleteBundle("k8s"); err == nil {
+			t.Error("expected error deleting an extended bundle, got nil")
+		}
+		b.SetActiveBundle("platform")
+	})
+
+	t.Run("rename updates children", func(t *testing.T) {
+		if err := b.RenameBundle("base", "core"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if extends := b.GetExtends("platform"); extends[0] != "core" {
+			t.Errorf("expected platform to extend core, got %v", extends)
+		}
+	})
+}
+
+func TestSetExtends(t *testing.T) {
+	b := newExtendingBundles()
+
+	invalid := map[string][]string{
+		"unknown parent": {"missing"},
+		"self":           {"base"},
+		"cycle":          {"platform"},
+	}
+	for name, parents := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if err := b.SetExtends("base", parents); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if extends := b.GetExtends("base"); len(extends) != 0 {
+				t.Errorf("expected extends to stay unchanged, got %v", extends)
+			}
+		})
+	}
+
+	t.Run("cycle on load", func(t *testing.T) {
+		b.bDefs.Bundles["base"].Extends = []string{"platform"}
+		data, _ := json.Marshal(b.bDefs)
+		e := &Environment{EnvironmentPath: filepath.Join(t.TempDir(), "env.json")}
+		if err := os.WriteFile(e.EnvironmentPath, data, 0644); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		if _, err := LoadBundleDefinitions(e); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
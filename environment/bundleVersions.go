@@ -0,0 +1,141 @@
+package environment
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/arafat/please/schema"
+	"github.com/arafat/please/utils/semver"
+)
+
+// GetPackageVersions returns every version of pkg in bundleName, the default
+// one first and the others newest first.
+func (b *Bundle) GetPackageVersions(bundleName, pkg string) []string {
+	resolved, ok := b.ResolvePackages(bundleName)[pkg]
+	if !ok {
+		return nil
+	}
+	return append([]string{resolved.Version}, b.bDefs.Bundles[resolved.Bundle].Versions[pkg]...)
+}
+
+// GetAllPackageVersions returns every version of every package in
+// bundleName, the default one of each package first.
+func (b *Bundle) GetAllPackageVersions(bundleName string) map[string][]string {
+	all := make(map[string][]string)
+	for pkg := range b.ResolvePackages(bundleName) {
+		all[pkg] = b.GetPackageVersions(bundleName, pkg)
+	}
+	return all
+}
+
+// AddPackageVersion adds version of pkg to bundleName next to the versions it
+// has already. It becomes the default only if the package is new.
+func (b *Bundle) AddPackageVersion(bundleName, pkg, version string) error {
+	bundle, err := b.ownPackage(bundleName, pkg)
+	if err != nil {
+		return err
+	}
+
+	current, ok := bundle.Packages[pkg]
+	switch {
+	case !ok:
+		bundle.Packages[pkg] = version
+	case current != version && !slices.Contains(bundle.Versions[pkg], version):
+		if bundle.Versions == nil {
+			bundle.Versions = make(map[string][]string)
+		}
+		bundle.Versions[pkg] = sortVersions(append(bundle.Versions[pkg], version))
+	}
+	return nil
+}
+
+// UsePackageVersion makes version, which bundleName has already, the default
+// version of pkg. The previous default stays next to it.
+func (b *Bundle) UsePackageVersion(bundleName, pkg, version string) error {
+	if !slices.Contains(b.GetPackageVersions(bundleName, pkg), version) {
+		return fmt.Errorf("bundle %q does not contain %s:%s", bundleName, pkg, version)
+	}
+	bundle, err := b.ownPackage(bundleName, pkg)
+	if err != nil {
+		return err
+	}
+
+	current := bundle.Packages[pkg]
+	if current == version {
+		return nil
+	}
+	others := slices.DeleteFunc(slices.Clone(bundle.Versions[pkg]), func(v string) bool { return v == version })
+	bundle.Packages[pkg] = version
+	bundle.Versions[pkg] = sortVersions(append(others, current))
+	return nil
+}
+
+// DeletePackageVersion removes a single version of pkg from the active
+// bundle. If it was the default, the newest remaining version takes over.
+func (b *Bundle) DeletePackageVersion(pkg, version string) error {
+	bundleName := b.GetActiveBundle()
+	versions := b.GetPackageVersions(bundleName, pkg)
+	if !slices.Contains(versions, version) {
+		return fmt.Errorf("bundle %q does not contain %s:%s", bundleName, pkg, version)
+	}
+	if len(versions) == 1 {
+		return b.DeletePackage(pkg)
+	}
+
+	bundle, err := b.ownPackage(bundleName, pkg)
+	if err != nil {
+		return err
+	}
+	if bundle.Packages[pkg] == version {
+		bundle.Packages[pkg] = bundle.Versions[pkg][0]
+		bundle.Versions[pkg] = bundle.Versions[pkg][1:]
+	} else {
+		bundle.Versions[pkg] = slices.DeleteFunc(bundle.Versions[pkg], func(v string) bool { return v == version })
+	}
+	if len(bundle.Versions[pkg]) == 0 {
+		delete(bundle.Versions, pkg)
+	}
+	delete(bundle.Lock, lockKey(pkg, version))
+	return nil
+}
+
+// ownPackage returns the definition of bundleName after copying pkg into it
+// if it is inherited, so that changing its versions overrides the parent.
+func (b *Bundle) ownPackage(bundleName, pkg string) (*schema.Bundle, error) {
+	bundle, ok := b.bDefs.Bundles[bundleName]
+	if !ok {
+		return nil, fmt.Errorf("bundle %q does not exist", bundleName)
+	}
+	if bundle.Packages == nil {
+		bundle.Packages = make(map[string]string)
+	}
+
+	resolved, ok := b.ResolvePackages(bundleName)[pkg]
+	if !ok || resolved.Bundle == bundleName {
+		return bundle, nil
+	}
+	parent := b.bDefs.Bundles[resolved.Bundle]
+	bundle.Packages[pkg] = resolved.Version
+	if inherited := parent.Versions[pkg]; len(inherited) > 0 {
+		if bundle.Versions == nil {
+			bundle.Versions = make(map[string][]string)
+		}
+		bundle.Versions[pkg] = slices.Clone(inherited)
+	}
+	for _, version := range b.GetPackageVersions(bundleName, pkg) {
+		if lock := parent.Lock[lockKey(pkg, version)]; lock != nil {
+			if bundle.Lock == nil {
+				bundle.Lock = make(map[string]*schema.PackageLock)
+			}
+			copied := *lock
+			bundle.Lock[lockKey(pkg, version)] = &copied
+		}
+	}
+	return bundle, nil
+}
+
+// sortVersions orders versions newest first.
+func sortVersions(versions []string) []string {
+	slices.SortFunc(versions, func(a, b string) int { return semver.Compare(b, a) })
+	return versions
+}
@@ -0,0 +1,122 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestPackageVersions(t *testing.T) {
+	newBundle := func() *Bundle {
+		return &Bundle{bDefs: &schema.BundleDefinitions{
+			ActiveBundle: "dev",
+			Bundles: map[string]*schema.Bundle{
+				"base": {
+					Packages: map[string]string{"python": "3.11"},
+					Versions: map[string][]string{"python": {"3.10"}},
+					Lock:     map[string]*schema.PackageLock{"python:3.10": {Digest: "sha256:base"}},
+				},
+				"dev": {Extends: []string{"base"}, Packages: map[string]string{"jq": "1.7"}},
+			},
+		}}
+	}
+
+	t.Run("add keeps the default", func(t *testing.T) {
+		b := newBundle()
+		if err := b.AddPackageVersion("base", "python", "3.12"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{"3.11", "3.12", "3.10"}
+		if got := b.GetPackageVersions("base", "python"); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		if !b.IsPackageInstalled("base", "python", "3.12") {
+			t.Error("expected python 3.12 to be installed in base")
+		}
+	})
+
+	t.Run("use switches the default", func(t *testing.T) {
+		b := newBundle()
+		if err := b.UsePackageVersion("base", "python", "3.10"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{"3.10", "3.11"}
+		if got := b.GetPackageVersions("base", "python"); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		if err := b.UsePackageVersion("base", "python", "3.9"); err == nil {
+			t.Error("expected error using a version the bundle does not have, got nil")
+		}
+	})
+
+	t.Run("use overrides an inherited package", func(t *testing.T) {
+		b := newBundle()
+		if err := b.UsePackageVersion("dev", "python", "3.10"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := b.GetPackageVersions("dev", "python"); !slices.Equal(got, []string{"3.10", "3.11"}) {
+			t.Errorf("expected [3.10 3.11], got %v", got)
+		}
+		if got := b.GetPackageVersions("base", "python"); !slices.Equal(got, []string{"3.11", "3.10"}) {
+			t.Errorf("expected base to be unchanged, got %v", got)
+		}
+		if digest := b.GetPackageDigest("dev", "python", "3.10"); digest != "sha256:base" {
+			t.Errorf("expected sha256:base, got %q", digest)
+		}
+	})
+
+	t.Run("delete a version", func(t *testing.T) {
+		b := newBundle()
+		b.SetActiveBundle("base")
+		if err := b.DeletePackageVersion("python", "3.11"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := b.GetPackageVersions("base", "python"); !slices.Equal(got, []string{"3.10"}) {
+			t.Errorf("expected [3.10], got %v", got)
+		}
+		if err := b.DeletePackageVersion("python", "3.10"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if versions := b.GetPackageVersions("base", "python"); versions != nil {
+			t.Errorf("expected python to be deleted, got %v", versions)
+		}
+		if digest := b.GetPackageDigest("base", "python", "3.10"); digest != "" {
+			t.Errorf("expected the lock to be deleted, got %q", digest)
+		}
+	})
+
+	t.Run("versions are linked with their executable", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		e := &Environment{PleasePath: tmpDir, VersionsPath: filepath.Join(tmpDir, "versions")}
+		for _, version := range []string{"3.10", "3.11"} {
+			installed := filepath.Join(e.VersionsPath, "python", version)
+			if err := os.MkdirAll(installed, 0755); err != nil {
+				t.Fatalf("setup failed: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(installed, "python.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+				t.Fatalf("setup failed: %v", err)
+			}
+		}
+
+		binPath, missing, _, err := e.LinkBundle(newBundle(), "base")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(missing) != 0 {
+			t.Errorf("expected nothing missing, got %v", missing)
+		}
+		for link, version := range map[string]string{"python": "3.11", "python@3.11": "3.11", "python@3.10": "3.10"} {
+			target, err := os.Readlink(filepath.Join(binPath, link))
+			if err != nil {
+				t.Fatalf("expected %s symlink, got %v", link, err)
+			}
+			expected := filepath.Join(e.VersionsPath, "python", version, "python.sh")
+			if target != expected {
+				t.Errorf("%s: expected %s, got %s", link, expected, target)
+			}
+		}
+	})
+}
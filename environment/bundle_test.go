@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/arafat/please/schema"
@@ -305,4 +306,188 @@ func TestAddBundle(t *testing.T) {
 			t.Fatal("expected error, got nil")
 		}
 	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		env := &Bundle{
+			bDefs: &schema.BundleDefinitions{
+				Bundles: map[string]*schema.Bundle{
+					"dev": {},
+				},
+			},
+		}
+
+		for _, name := range []string{"", "..", "../prod", "a/b", ".hidden", "-rf", "dev XXXXXX"} {
+			if err := env.AddBundle(name, ""); err == nil {
+				t.Errorf("%q: expected error, got nil", name)
+			}
+			if err := env.CloneBundle("dev", name); err == nil {
+				t.Errorf("%q: expected clone to fail, got nil", name)
+			}
+			if err := env.RenameBundle("dev", name); err == nil {
+				t.Errorf("%q: expected rename to fail, got nil", name)
+			}
+		}
+		if len(env.bDefs.Bundles) != 1 {
+			t.Errorf("expected only dev, got %v", env.ListBundles())
+		}
+	})
+}
+
+func TestPackageDigest(t *testing.T) {
+	t.Run("pin and replace", func(t *testing.T) {
+		env := &Bundle{
+			bDefs: &schema.BundleDefinitions{
+				Bundles: map[string]*schema.Bundle{
+					"dev": {Packages: map[string]string{"pkg": "v1.0.0"}},
+				},
+			},
+		}
+
+		if err := env.SetPackageDigest("dev", "pkg", "v1.0.0", "sha256:abc"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if digest := env.GetPackageDigest("dev", "pkg", "v1.0.0"); digest != "sha256:abc" {
+			t.Errorf("expected sha256:abc, got %q", digest)
+		}
+
+		env.AddPackage("dev", "pkg", "v2.0.0")
+
+		if digest := env.GetPackageDigest("dev", "pkg", "v1.0.0"); digest != "" {
+			t.Errorf("expected pin of replaced version to be dropped, got %q", digest)
+		}
+	})
+
+	t.Run("bundle not found", func(t *testing.T) {
+		env := &Bundle{
+			bDefs: &schema.BundleDefinitions{
+				Bundles: map[string]*schema.Bundle{},
+			},
+		}
+
+		err := env.SetPackageDigest("nonexistent", "pkg", "v1.0.0", "sha256:abc")
+
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestPackageConstraint(t *testing.T) {
+	env := &Bundle{
+		bDefs: &schema.BundleDefinitions{
+			Bundles: map[string]*schema.Bundle{
+				"dev":  {Packages: map[string]string{"kubectl": "1.29.3"}},
+				"prod": {Packages: map[string]string{"kubectl": "1.28.0"}},
+				"ci":   {Packages: map[string]string{"kubectl": "1.29.3"}},
+			},
+		},
+	}
+
+	t.Run("record and pin", func(t *testing.T) {
+		if err := env.SetPackageConstraint("dev", "kubectl", "1.29.3", "^1.29"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if c := env.GetPackageConstraint("dev", "kubectl", "1.29.3"); c != "^1.29" {
+			t.Errorf("expected ^1.29, got %q", c)
+		}
+		if c := env.GetPackageConstraint("prod", "kubectl", "1.28.0"); c != "" {
+			t.Errorf("expected pinned version without constraint, got %q", c)
+		}
+	})
+
+	t.Run("bundles using version", func(t *testing.T) {
+		users := env.BundlesUsing("kubectl", "1.29.3")
+		if len(users) != 2 || users[0] != "ci" || users[1] != "dev" {
+			t.Errorf("expected [ci dev], got %v", users)
+		}
+		if users := env.BundlesUsing("kubectl", "1.27.0"); len(users) != 0 {
+			t.Errorf("expected no bundles, got %v", users)
+		}
+	})
+}
+
+func TestBundleManagement(t *testing.T) {
+	b := &Bundle{bDefs: &schema.BundleDefinitions{
+		ActiveBundle: "default",
+		Bundles: map[string]*schema.Bundle{
+			"default": {
+				Description: "Everyday tools",
+				Packages:    map[string]string{"kubectl": "1.28.0", "jq": "1.7"},
+				Lock:        map[string]*schema.PackageLock{"kubectl:1.28.0": {Digest: "sha256:abc"}},
+			},
+		},
+	}}
+
+	t.Run("clone copies packages and pins", func(t *testing.T) {
+		if err := b.CloneBundle("default", "next"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := b.CloneBundle("default", "next"); err == nil {
+			t.Error("expected error cloning onto an existing bundle, got nil")
+		}
+		if d := b.GetPackageDigest("next", "kubectl", "1.28.0"); d != "sha256:abc" {
+			t.Errorf("expected sha256:abc, got %s", d)
+		}
+		if desc := b.GetDescription("next"); desc != "Everyday tools" {
+			t.Errorf("expected description to be copied, got %q", desc)
+		}
+
+		// The clone is independent of its source
+		b.AddPackage("next", "kubectl", "1.29.0")
+		b.AddPackage("next", "helm", "3.14.0")
+		if v := b.GetInstalledPackages("default")["kubectl"]; v != "1.28.0" {
+			t.Errorf("expected source to keep kubectl 1.28.0, got %s", v)
+		}
+		if d := b.GetPackageDigest("default", "kubectl", "1.28.0"); d != "sha256:abc" {
+			t.Errorf("expected source to keep its pin, got %q", d)
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		b.bDefs.Bundles["default"].Packages["yq"] = "4.40"
+		b.AddPackage("next", "jq", "1.7")
+		b.AddPackage("default", "jq", "1.7")
+		b.AddPackageVersion("next", "jq", "1.6")
+
+		changes, err := b.DiffBundles("default", "next")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []PackageChange{
+			{"helm", nil, []string{"3.14.0"}},
+			{"jq", []string{"1.7"}, []string{"1.7", "1.6"}},
+			{"kubectl", []string{"1.28.0"}, []string{"1.29.0"}},
+			{"yq", []string{"4.40"}, nil},
+		}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("expected %v, got %v", expected, changes)
+		}
+	})
+
+	t.Run("rename keeps the active bundle", func(t *testing.T) {
+		if err := b.RenameBundle("default", "main"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if active := b.GetActiveBundle(); active != "main" {
+			t.Errorf("expected main, got %s", active)
+		}
+		if b.BundleExists("default") {
+			t.Error("expected default to be gone")
+		}
+		if err := b.RenameBundle("main", "next"); err == nil {
+			t.Error("expected error renaming onto an existing bundle, got nil")
+		}
+
+		b.session = "next"
+		if err := b.RenameBundle("next", "later"); err == nil {
+			t.Error("expected error renaming the session bundle, got nil")
+		}
+	})
+
+	t.Run("bundles are listed sorted", func(t *testing.T) {
+		names := b.ListBundles()
+		if len(names) != 2 || names[0] != "main" || names[1] != "next" {
+			t.Errorf("expected [main next], got %v", names)
+		}
+	})
 }
@@ -0,0 +1,298 @@
+package environment
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// manifestMeta is stored next to a downloaded archive as <archive>.meta. It
+// carries the validators for conditional requests and, for signed sources,
+// the verified signature metadata.
+type manifestMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	SHA256       string    `json:"sha256,omitempty"`
+	Version      int64     `json:"version,omitempty"`
+	Expires      time.Time `json:"expires,omitzero"`
+}
+
+// DownloadResult reports the outcome of fetching one manifest source.
+type DownloadResult struct {
+	URL         string
+	File        string
+	NotModified bool
+	Verified    bool
+	Err         error
+}
+
+// DownloadManifestFiles fetches all manifest sources concurrently. A source
+// that fails keeps its previously downloaded archive. The returned error joins
+// the errors of all failed sources.
+func (e *Environment) DownloadManifestFiles(urls []string) ([]DownloadResult, error) {
+	trustStore, err := LoadTrustStore(e)
+	if err != nil {
+		return nil, err
+	}
+
+	client := e.HTTPClient()
+	p := mpb.New(mpb.WithWidth(60))
+	results := make([]DownloadResult, len(urls))
+
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		fileName := path.Base(url)
+		results[i] = DownloadResult{URL: url, File: e.ManifestPath(fileName)}
+		keys, err := trustStore.KeysFor(url)
+		if err != nil {
+			results[i].Err = err
+			wg.Done()
+			continue
+		}
+		results[i].Verified = len(keys) > 0
+		go func(r *DownloadResult) {
+			defer wg.Done()
+			r.NotModified, r.Err = downloadManifest(client, r.URL, r.File, p, keys)
+		}(&results[i])
+	}
+	wg.Wait()
+	p.Wait()
+
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.URL, r.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func metaPath(filename string) string {
+	return filename + ".meta"
+}
+
+func loadManifestMeta(filename string) *manifestMeta {
+	data, err := os.ReadFile(metaPath(filename))
+	if err != nil {
+		return nil
+	}
+
+	var meta manifestMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+func saveManifestMeta(filename string, meta *manifestMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest metadata: %w", err)
+	}
+	return os.WriteFile(metaPath(filename), data, 0644)
+}
+
+// downloadManifest downloads url into a temporary file next to filename,
+// validates it and atomically replaces filename. If keys are given, the
+// archive must carry a valid detached signature from one of them. It reports
+// notModified if the server confirmed the local copy is current.
+func downloadManifest(client *http.Client, url, filename string, p *mpb.Progress, keys []ed25519.PublicKey) (notModified bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+
+	meta := loadManifestMeta(filename)
+	if _, statErr := os.Stat(filename); statErr != nil || meta == nil || meta.URL != url {
+		meta = nil
+	}
+
+	// Only send validators if the archive they belong to is still present and,
+	// for signed sources, its signed metadata has been verified and not expired
+	useValidators := meta != nil
+	if len(keys) > 0 && meta != nil && (meta.SHA256 == "" || !time.Now().Before(meta.Expires)) {
+		useValidators = false
+	}
+	if useValidators {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("Error downloading: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.download")
+	if err != nil {
+		return false, fmt.Errorf("Error creating file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Get content length (if provided)
+	size := resp.ContentLength
+	if size <= 0 {
+		size = 0 // unknown size
+	}
+
+	bar := p.AddBar(
+		size,
+		mpb.PrependDecorators(
+			decor.Name(filepath.Base(filename)+" "),
+			decor.CountersKibiByte("% .2f / % .2f"),
+		),
+		mpb.AppendDecorators(
+			decor.Percentage(),
+		),
+	)
+
+	proxyReader := bar.ProxyReader(resp.Body)
+	defer proxyReader.Close()
+
+	_, err = io.Copy(tmp, proxyReader)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		bar.Abort(false)
+		return false, fmt.Errorf("Error writing to file: %w", err)
+	}
+	bar.SetTotal(-1, true)
+
+	if err := validateManifestArchive(tmp.Name()); err != nil {
+		return false, fmt.Errorf("invalid manifest archive: %w", err)
+	}
+
+	newMeta := &manifestMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if len(keys) > 0 {
+		if err := verifyDownloadedManifest(client, url, tmp.Name(), keys, meta, newMeta); err != nil {
+			return false, err
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return false, fmt.Errorf("failed to replace %s: %w", filename, err)
+	}
+
+	if err := saveManifestMeta(filename, newMeta); err != nil {
+		return false, fmt.Errorf("failed to save manifest metadata: %w", err)
+	}
+
+	return false, nil
+}
+
+// verifyDownloadedManifest checks the detached signature of the archive at
+// path and records the verified metadata in newMeta. Archives older than the
+// installed one, or reusing its version for different content, are rejected.
+func verifyDownloadedManifest(client *http.Client, url, path string, keys []ed25519.PublicKey, installed, newMeta *manifestMeta) error {
+	sig, err := fetchManifestSignature(client, url)
+	if err != nil {
+		return err
+	}
+
+	checksum, err := archiveChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	var installedVersion int64
+	if installed != nil {
+		installedVersion = installed.Version
+		if sig.Version == installed.Version && installed.SHA256 != "" && installed.SHA256 != checksum {
+			return fmt.Errorf("signature verification failed: version %d was already installed with different content", sig.Version)
+		}
+	}
+
+	if err := sig.Verify(checksum, keys, installedVersion, time.Now()); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	newMeta.SHA256 = checksum
+	newMeta.Version = sig.Version
+	newMeta.Expires = sig.Expires
+	return nil
+}
+
+// validateManifestArchive checks that path is a complete gzip compressed tar
+// whose root JSON document decodes into manifests.
+func validateManifestArchive(path string) error {
+	manifestDecoder, err := NewManifestDecoder(path)
+	if err != nil {
+		return err
+	}
+	for manifestDecoder.decoder.More() {
+		var raw json.RawMessage
+		if err := manifestDecoder.decoder.Decode(&raw); err != nil {
+			manifestDecoder.Close()
+			return fmt.Errorf("failed to decode object: %w", err)
+		}
+	}
+	manifestDecoder.Close()
+
+	// Read the whole stream so truncated archives fail the gzip checksum
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+	}
+	if _, err := io.Copy(io.Discard, gzr); err != nil {
+		return fmt.Errorf("failed to read gzip stream: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package environment
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestDownloadManifestFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "source.tar.gz")
+	writeManifestArchive(t, archive, "core", []schema.PackageManifest{{Name: "jq"}}, nil)
+	valid, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	body := valid
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && status == http.StatusOK && string(body) == string(valid) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	manifestDir := filepath.Join(tmpDir, "manifests")
+	if err := os.MkdirAll(manifestDir, 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	e := &Environment{manifestPath: manifestDir}
+	url := server.URL + "/manifest-core.tar.gz"
+	target := e.ManifestPath("manifest-core.tar.gz")
+
+	t.Run("initial download", func(t *testing.T) {
+		results, err := e.DownloadManifestFiles([]string{url})
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if results[0].NotModified {
+			t.Error("expected a fresh download")
+		}
+		if meta := loadManifestMeta(target); meta == nil || meta.ETag != `"v1"` {
+			t.Errorf("expected ETag to be recorded, got %+v", meta)
+		}
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		results, err := e.DownloadManifestFiles([]string{url})
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !results[0].NotModified {
+			t.Error("expected conditional request to report not modified")
+		}
+	})
+
+	t.Run("invalid body keeps previous archive", func(t *testing.T) {
+		body = []byte("<html>maintenance</html>")
+
+		_, err := e.DownloadManifestFiles([]string{url})
+
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if err := validateManifestArchive(target); err != nil {
+			t.Errorf("expected previous archive to be intact, got %v", err)
+		}
+	})
+
+	t.Run("server error keeps previous archive", func(t *testing.T) {
+		body, status = valid, http.StatusInternalServerError
+
+		_, err := e.DownloadManifestFiles([]string{url})
+
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if err := validateManifestArchive(target); err != nil {
+			t.Errorf("expected previous archive to be intact, got %v", err)
+		}
+	})
+}
@@ -7,28 +7,24 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sync"
 
 	"github.com/arafat/please/artifacts"
-	"github.com/vbauerster/mpb/v8"
-	"github.com/vbauerster/mpb/v8/decor"
+	"github.com/arafat/please/config"
+	"github.com/arafat/please/container"
 )
 
 const (
-	defaultSourceURL = "https://please.oarafat.workers.dev/manifest-core.tar.gz"
-	sourcesFile      = "sources"
-	pleaseDir        = ".please"
+	sourcesFile = "sources"
+
+	// SessionBundleEnv names the bundle of the surrounding please shell.
+	SessionBundleEnv = "PLEASE_BUNDLE"
 )
 
 type Environment struct {
-	homePath         string
 	PleasePath       string
 	manifestPath     string
 	ManifestCoreFile string
@@ -38,27 +34,58 @@ type Environment struct {
 	Platform         string
 	Arch             string
 	OS               string
+	// Config holds the merged global and project settings. ConfigErr is set
+	// and Config falls back to the defaults if they could not be loaded.
+	Config    *config.Config
+	ConfigErr error
+	// SessionBundle is the bundle of the please shell the command runs in.
+	SessionBundle string
 }
 
 func New() *Environment {
-	homeDir, _ := os.UserHomeDir()
-	arch := strings.ToLower(runtime.GOARCH)
-	os := "linux" // no darwin images available strings.ToLower(runtime.GOOS)
+	pleasePath := config.PleasePath()
+	workDir, _ := os.Getwd()
+
+	cfg, err := config.Load(filepath.Join(pleasePath, config.FileName), workDir)
+	if err != nil {
+		cfg = config.Default()
+	}
 
 	return &Environment{
-		homePath:         homeDir,
-		PleasePath:       fmt.Sprintf("%s/%s", homeDir, pleaseDir),
-		manifestPath:     fmt.Sprintf("%s/%s/%s", homeDir, pleaseDir, "manifests"),
-		ManifestCoreFile: fmt.Sprintf("%s/%s/%s/%s", homeDir, pleaseDir, "manifests", "manifest-core.tar.gz"),
-		EnvironmentPath:  fmt.Sprintf("%s/%s/%s", homeDir, pleaseDir, "env.json"),
-		BinPath:          fmt.Sprintf("%s/%s/%s", homeDir, pleaseDir, "bin"),
-		VersionsPath:     fmt.Sprintf("%s/%s/%s", homeDir, pleaseDir, "versions"),
-		Platform:         fmt.Sprintf("%s/%s", os, arch),
-		Arch:             arch,
-		OS:               os,
+		PleasePath:       pleasePath,
+		manifestPath:     filepath.Join(pleasePath, "manifests"),
+		ManifestCoreFile: filepath.Join(pleasePath, "manifests", "manifest-core.tar.gz"),
+		EnvironmentPath:  filepath.Join(pleasePath, "env.json"),
+		BinPath:          filepath.Join(pleasePath, "bin"),
+		VersionsPath:     filepath.Join(pleasePath, "versions"),
+		Platform:         cfg.Platform,
+		Arch:             cfg.Arch(),
+		OS:               cfg.OS(),
+		Config:           cfg,
+		ConfigErr:        err,
+		SessionBundle:    os.Getenv(SessionBundleEnv),
 	}
 }
 
+// ConfigPath returns the path of the global configuration file.
+func (e *Environment) ConfigPath() string {
+	return filepath.Join(e.PleasePath, config.FileName)
+}
+
+// HTTPClient returns a client honouring the configured proxy and timeout.
+func (e *Environment) HTTPClient() *http.Client {
+	if e.Config == nil {
+		return http.DefaultClient
+	}
+	return e.Config.HTTPClient()
+}
+
+// RegistryClient returns a registry client using HTTPClient and the
+// credentials in the please directory.
+func (e *Environment) RegistryClient() *container.RegistryClient {
+	return container.NewRegistryClient(e.HTTPClient(), container.NewCredentialStore(e.PleasePath))
+}
+
 func (e *Environment) DeployArtifact(d artifacts.Deployable, pkg, executable, version string) (string, error) {
 	installationFullPath := fmt.Sprintf("%s/%s/%s/%s.sh", e.VersionsPath, pkg, version, executable)
 	installationPath := fmt.Sprintf("%s/%s/%s", e.VersionsPath, pkg, version)
@@ -153,20 +180,6 @@ func (e *Environment) LoadSources() ([]string, error) {
 	return sources, nil
 }
 
-func (e *Environment) DownloadManifestFiles(urls []string) {
-
-	p := mpb.New(mpb.WithWidth(60))
-	var wg sync.WaitGroup
-	for _, url := range urls {
-		// TODO: Check ETag - if no new version skip download
-		wg.Add(1)
-		fileName := path.Base(url)
-		go downloadManifest(url, e.ManifestPath(fileName), p, &wg)
-	}
-	wg.Wait()
-	p.Wait()
-}
-
 func (e *Environment) SourcesPath() string {
 	return filepath.Join(e.PleasePath, sourcesFile)
 }
@@ -210,7 +223,11 @@ func (e *Environment) createSources() error {
 	path := e.SourcesPath()
 
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		content := fmt.Sprintf("# please package sources\n# Add one URL per line\n\n%s\n", defaultSourceURL)
+		source := config.DefaultSourceURL
+		if e.Config != nil && e.Config.Source != "" {
+			source = e.Config.Source
+		}
+		content := fmt.Sprintf("# please package sources\n# Add one URL per line\n\n%s\n", source)
 		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to create sources file: %w", err)
 		}
@@ -218,52 +235,3 @@ func (e *Environment) createSources() error {
 
 	return nil
 }
-
-func downloadManifest(url, filename string, p *mpb.Progress, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	// Create output file
-	out, err := os.Create(filename)
-	if err != nil {
-		fmt.Println("Error creating file:", err)
-		return
-	}
-	defer out.Close()
-
-	// Perform request
-	resp, err := http.Get(url)
-	if err != nil {
-		fmt.Println("Error downloading:", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Get content length (if provided)
-	size := resp.ContentLength
-	if size <= 0 {
-		size = 0 // unknown size
-	}
-
-	// Create progress bar
-	bar := p.AddBar(
-		size,
-		mpb.PrependDecorators(
-			decor.Name(filepath.Base(filename)+" "),
-			decor.CountersKibiByte("% .2f / % .2f"),
-		),
-		mpb.AppendDecorators(
-			decor.Percentage(),
-		),
-	)
-
-	// Wrap reader with proxy for bar
-	proxyReader := bar.ProxyReader(resp.Body)
-	defer proxyReader.Close()
-
-	// Copy data to file
-	_, err = io.Copy(out, proxyReader)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return
-	}
-}
@@ -0,0 +1,292 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const journalDir = "journal"
+
+// Operation journals a change to the installed packages so that a command
+// interrupted half way can be completed or undone by the next one. The steps
+// of an operation are: record the artifacts it creates, deploy them, Commit
+// the bundle definitions, and Finish by removing the artifacts it made
+// obsolete. An operation interrupted before the commit is rolled back, one
+// interrupted after it is rolled forward. One interrupted while committing
+// is rolled forward if the saved bundle definitions already reflect it.
+type Operation struct {
+	Name       string     `json:"name"`
+	Bundle     string     `json:"bundle"`
+	Started    time.Time  `json:"started"`
+	PID        int        `json:"pid"`
+	Committing bool       `json:"committing,omitempty"`
+	Committed  bool       `json:"committed"`
+	Created    []Artifact `json:"created,omitempty"`
+	Obsolete   []Artifact `json:"obsolete,omitempty"`
+
+	path string
+	e    *Environment
+}
+
+// Artifact is an installed package version in the versions directory.
+type Artifact struct {
+	Package string `json:"package"`
+	Version string `json:"version"`
+}
+
+func (a Artifact) String() string {
+	return fmt.Sprintf("%s:%s", a.Package, a.Version)
+}
+
+// JournalPath returns the directory holding the journals of unfinished
+// operations.
+func (e *Environment) JournalPath() string {
+	return filepath.Join(e.PleasePath, journalDir)
+}
+
+// BeginOperation starts journaling the operation name on bundleName.
+func (e *Environment) BeginOperation(name, bundleName string) (*Operation, error) {
+	if err := os.MkdirAll(e.JournalPath(), 0755); err != nil {
+		return nil, fmt.Errorf("Error creating directories:%w", err)
+	}
+	f, err := os.CreateTemp(e.JournalPath(), name+"-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	f.Close()
+
+	op := &Operation{Name: name, Bundle: bundleName, Started: time.Now(), PID: os.Getpid(), path: f.Name(), e: e}
+	if err := op.write(); err != nil {
+		os.Remove(op.path)
+		return nil, err
+	}
+	return op, nil
+}
+
+// Creates records that the operation is about to deploy pkg:version. Versions
+// that are installed already are not recorded, rolling back leaves them alone.
+func (o *Operation) Creates(pkg, version string) error {
+	if _, err := os.Stat(filepath.Join(o.e.VersionsPath, pkg, version)); err == nil {
+		return nil
+	}
+	o.Created = append(o.Created, Artifact{pkg, version})
+	return o.write()
+}
+
+// Obsoletes records that pkg:version is to be removed once the operation is
+// committed.
+func (o *Operation) Obsoletes(pkg, version string) error {
+	o.Obsolete = append(o.Obsolete, Artifact{pkg, version})
+	return o.write()
+}
+
+// Commit saves the bundle definitions, the point of no return of the
+// operation.
+func (o *Operation) Commit(b *Bundle) error {
+	o.Committing = true
+	if err := o.write(); err != nil {
+		return err
+	}
+	if err := b.SaveBundle(o.e); err != nil {
+		return err
+	}
+	o.Committed = true
+	return o.write()
+}
+
+// savedIn reports whether the bundle definitions b were saved by the
+// operation: a bundle uses one of the artifacts it created or, if it created
+// none, no bundle uses the artifacts it made obsolete anymore.
+func (o *Operation) savedIn(b *Bundle) bool {
+	for _, a := range o.Created {
+		if len(b.BundlesUsing(a.Package, a.Version)) > 0 {
+			return true
+		}
+	}
+	if len(o.Created) > 0 {
+		return false
+	}
+	for _, a := range o.Obsolete {
+		if len(b.BundlesUsing(a.Package, a.Version)) > 0 {
+			return false
+		}
+	}
+	return len(o.Obsolete) > 0
+}
+
+// Finish removes the obsolete artifacts of a committed operation, or the
+// created ones of an uncommitted operation, and then its journal.
+func (o *Operation) Finish() error {
+	artifacts := o.Obsolete
+	if !o.Committed {
+		artifacts = o.Created
+	}
+
+	var errs []error
+	for _, a := range artifacts {
+		if err := o.e.DeleteArtifact(a.Package, a.Version); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if err := os.Remove(o.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+func (o *Operation) write() error {
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+	if err := writeFileAtomic(o.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// PendingOperations loads the journals left behind by interrupted commands,
+// oldest first. Operations of commands that are still running are skipped.
+func (e *Environment) PendingOperations() ([]*Operation, error) {
+	journals, err := e.journals()
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []*Operation
+	for _, op := range journals {
+		if op.PID != os.Getpid() && processRunning(op.PID) {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// journals loads the journals of all unfinished operations, including those
+// of commands that are still running, oldest first.
+func (e *Environment) journals() ([]*Operation, error) {
+	entries, err := os.ReadDir(e.JournalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var ops []*Operation
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(e.JournalPath(), entry.Name())
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			// Finished since the directory was read
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+
+		op := &Operation{path: path, e: e}
+		if err := json.Unmarshal(data, op); err != nil {
+			// Interrupted before the journal was written, nothing happened yet
+			if len(data) == 0 {
+				os.Remove(path)
+				continue
+			}
+			return nil, fmt.Errorf("failed to unmarshal journal %s: %w", path, err)
+		}
+		ops = append(ops, op)
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Started.Before(ops[j].Started) })
+	return ops, nil
+}
+
+// Recover completes the interrupted operations, rolling each forward or back,
+// and relinks the bin directories of the bundles they touched.
+func (e *Environment) Recover() ([]*Operation, error) {
+	ops, err := e.PendingOperations()
+	if err != nil || len(ops) == 0 {
+		return nil, err
+	}
+
+	b, err := LoadBundleDefinitions(e)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		// Interrupted between saving the bundle definitions and journaling it
+		if op.Committing && !op.Committed && op.savedIn(b) {
+			op.Committed = true
+		}
+		if err := op.Finish(); err != nil {
+			return nil, fmt.Errorf("failed to recover %s: %w", op.Name, err)
+		}
+	}
+
+	if _, _, err := e.ActivateBundle(b, b.GetDefaultBundle()); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.Bundle == b.GetDefaultBundle() || !b.BundleExists(op.Bundle) {
+			continue
+		}
+		if _, err := os.Stat(e.BundleBinPath(op.Bundle)); err == nil {
+			if _, _, _, err := e.LinkBundle(b, op.Bundle); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ops, nil
+}
+
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// writeFileAtomic replaces path with data so that readers see either the old
+// or the new content.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
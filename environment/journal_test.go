@@ -0,0 +1,196 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestRecover(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:      tmpDir,
+		BinPath:         filepath.Join(tmpDir, "bin"),
+		VersionsPath:    filepath.Join(tmpDir, "versions"),
+		EnvironmentPath: filepath.Join(tmpDir, "env.json"),
+	}
+
+	install := func(pkg, version string) {
+		installed := filepath.Join(e.VersionsPath, pkg, version)
+		if err := os.MkdirAll(installed, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installed, pkg+".sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	installed := func(pkg, version string) bool {
+		_, err := os.Stat(filepath.Join(e.VersionsPath, pkg, version))
+		return err == nil
+	}
+	install("jq", "1.6")
+
+	data, _ := json.Marshal(&schema.BundleDefinitions{
+		ActiveBundle: "default",
+		Bundles: map[string]*schema.Bundle{
+			"default": {Packages: map[string]string{"jq": "1.6"}},
+		},
+	})
+	if err := os.WriteFile(e.EnvironmentPath, data, 0644); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	t.Run("uncommitted operation is rolled back", func(t *testing.T) {
+		op, err := e.BeginOperation("install", "default")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := op.Creates("jq", "1.6"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := op.Creates("yq", "4.40"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		install("yq", "4.40")
+
+		ops, err := e.Recover()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(ops) != 1 || ops[0].Committed {
+			t.Fatalf("expected one uncommitted operation, got %v", ops)
+		}
+		if installed("yq", "4.40") {
+			t.Error("expected yq:4.40 to be removed")
+		}
+		if !installed("jq", "1.6") {
+			t.Error("expected jq:1.6, installed before the operation, to be kept")
+		}
+	})
+
+	t.Run("committed operation is rolled forward", func(t *testing.T) {
+		b, err := LoadBundleDefinitions(e)
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		op, err := e.BeginOperation("upgrade", "default")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := op.Creates("jq", "1.7"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		install("jq", "1.7")
+		if err := op.Obsoletes("jq", "1.6"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		b.AddPackage("default", "jq", "1.7")
+		if err := op.Commit(b); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		ops, err := e.Recover()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(ops) != 1 || !ops[0].Committed {
+			t.Fatalf("expected one committed operation, got %v", ops)
+		}
+		if installed("jq", "1.6") {
+			t.Error("expected jq:1.6 to be removed")
+		}
+		if !installed("jq", "1.7") {
+			t.Error("expected jq:1.7 to be kept")
+		}
+
+		target, err := os.Readlink(filepath.Join(e.BinPath, "jq"))
+		if err != nil {
+			t.Fatalf("expected jq symlink, got %v", err)
+		}
+		if expected := filepath.Join(e.VersionsPath, "jq", "1.7", "jq.sh"); target != expected {
+			t.Errorf("expected %s, got %s", expected, target)
+		}
+	})
+
+	t.Run("operation interrupted while committing is rolled forward", func(t *testing.T) {
+		b, err := LoadBundleDefinitions(e)
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		op, err := e.BeginOperation("upgrade", "default")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := op.Creates("jq", "1.8"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		install("jq", "1.8")
+		if err := op.Obsoletes("jq", "1.7"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// Crash after saving the definitions, before journaling the commit
+		op.Committing = true
+		if err := op.write(); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		b.AddPackage("default", "jq", "1.8")
+		if err := b.SaveBundle(e); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		ops, err := e.Recover()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(ops) != 1 || !ops[0].Committed {
+			t.Fatalf("expected one committed operation, got %v", ops)
+		}
+		if !installed("jq", "1.8") {
+			t.Error("expected jq:1.8, referenced by env.json, to be kept")
+		}
+		if installed("jq", "1.7") {
+			t.Error("expected jq:1.7 to be removed")
+		}
+	})
+
+	t.Run("operation interrupted before saving is rolled back", func(t *testing.T) {
+		op, err := e.BeginOperation("install", "default")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := op.Creates("yq", "4.40"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		install("yq", "4.40")
+		op.Committing = true
+		if err := op.write(); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		ops, err := e.Recover()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(ops) != 1 || ops[0].Committed {
+			t.Fatalf("expected one uncommitted operation, got %v", ops)
+		}
+		if installed("yq", "4.40") {
+			t.Error("expected yq:4.40 to be removed")
+		}
+	})
+
+	t.Run("journal is empty afterwards", func(t *testing.T) {
+		ops, err := e.PendingOperations()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(ops) != 0 {
+			t.Errorf("expected no pending operations, got %d", len(ops))
+		}
+	})
+}
@@ -23,13 +23,26 @@ type ManifestArchive struct {
 	Path      string
 	Namespace string
 	Count     int
+
+	index *archiveIndex
 }
 
+// NewManifestArchive opens the archive at path through its on-disk index,
+// building the index first if needed. If the index cannot be built, lookups
+// fall back to streaming the archive.
 func NewManifestArchive(path string) *ManifestArchive {
 	m := &ManifestArchive{
 		Path:  path,
 		Count: 0,
 	}
+
+	if idx, err := loadOrBuildIndex(path); err == nil {
+		m.index = idx
+		m.Namespace = idx.Namespace
+		m.Count = len(idx.Names)
+		return m
+	}
+
 	for range m.iterateManifest() {
 		m.Count++
 	}
@@ -43,6 +56,7 @@ func (m *ManifestArchive) iterateManifest() iter.Seq2[manifestIterator, error] {
 		manifestDecoder, err := NewManifestDecoder(m.Path)
 		if err != nil {
 			yield(manifestIterator{}, err)
+			return
 		}
 		defer manifestDecoder.Close()
 		m.Namespace = manifestDecoder.namespace
@@ -65,6 +79,22 @@ func (m *ManifestArchive) iterateManifest() iter.Seq2[manifestIterator, error] {
 const MaxFuzzySearchResults = 10
 
 func (m *ManifestArchive) ExactMatch(name string) (*schema.PackageManifest, error) {
+	if m.index != nil {
+		pm, err := m.index.manifest(name)
+		if err == nil {
+			return pm, nil
+		}
+		if _, ok := m.index.Manifests[name]; !ok {
+			return nil, err
+		}
+		// The data file is damaged, rebuild the index and retry once
+		if m.index, err = buildIndex(m.Path, m.index.Checksum); err != nil {
+			m.index = nil
+		} else {
+			return m.index.manifest(name)
+		}
+	}
+
 	for iter, err := range m.iterateManifest() {
 		if err != nil {
 			return nil, fmt.Errorf("iteration failed: %w", err)
@@ -89,6 +119,10 @@ func (m *ManifestArchive) getFuzzyCandidates(query string, maxResults int) []can
 		maxDistance = 1
 	}
 
+	if m.index != nil {
+		return m.getIndexedFuzzyCandidates(query, maxResults, maxDistance)
+	}
+
 	var candidates []candidate
 	for iter, _ := range m.iterateManifest() {
 		if len(candidates) >= maxResults {
@@ -112,6 +146,35 @@ func (m *ManifestArchive) getFuzzyCandidates(query string, maxResults int) []can
 	return candidates
 }
 
+func (m *ManifestArchive) getIndexedFuzzyCandidates(query string, maxResults, maxDistance int) []candidate {
+	var candidates []candidate
+	for _, name := range m.index.Names {
+		if len(candidates) >= maxResults {
+			break
+		}
+
+		distance := levenshtein.ComputeDistance(query, name)
+		if distance > maxDistance {
+			continue
+		}
+
+		pm, err := m.index.manifest(name)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			manifest: *pm,
+			distance: distance,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	return candidates
+}
+
 // FuzzySearch performs fuzzy search on object names and returns matching objects
 func (m *ManifestArchive) FuzzySearch(query string, maxResults int) ([]schema.PackageManifest, error) {
 	candidates := m.getFuzzyCandidates(query, maxResults)
@@ -136,6 +199,13 @@ type ScriptHooks struct {
 // LoadScriptHooksFromManifest reads the package name from JSON and returns
 // both prehook and posthook scripts if they exist
 func (m *ManifestArchive) LoadScriptHooksFromManifest(packageName string) (*ScriptHooks, error) {
+	if m.index != nil {
+		if hooks, ok := m.index.Hooks[packageName]; ok {
+			return &ScriptHooks{PreHook: hooks.PreHook, PostHook: hooks.PostHook}, nil
+		}
+		return &ScriptHooks{}, nil
+	}
+
 	preHookName := fmt.Sprintf("%s_install.sh", packageName)
 	postHookName := fmt.Sprintf("%s_cleanup.sh", packageName)
 
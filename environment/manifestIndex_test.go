@@ -0,0 +1,111 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestManifestArchiveIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	archivePath := filepath.Join(tmpDir, "manifest-core.tar.gz")
+	writeManifestArchive(t, archivePath, "core", []schema.PackageManifest{
+		{Name: "jq", Exec: "jq", Categories: []string{"json"}},
+		{Name: "yq", Exec: "yq", Categories: []string{"json", "yaml"}},
+		{Name: "python", Exec: "python3"},
+	}, map[string]string{
+		"jq_install.sh": "echo install",
+		"jq_cleanup.sh": "echo cleanup",
+	})
+
+	t.Run("lookups", func(t *testing.T) {
+		ma := NewManifestArchive(archivePath)
+
+		if ma.index == nil {
+			t.Fatal("expected archive to be indexed")
+		}
+		if ma.Namespace != "core" || ma.Count != 3 {
+			t.Errorf("expected core with 3 packages, got %s with %d", ma.Namespace, ma.Count)
+		}
+
+		pm, err := ma.ExactMatch("yq")
+		if err != nil || pm.Exec != "yq" {
+			t.Fatalf("expected yq, got %v, %v", pm, err)
+		}
+
+		hooks, err := ma.LoadScriptHooksFromManifest("jq")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hooks.PreHook != "echo install" || hooks.PostHook != "echo cleanup" {
+			t.Errorf("unexpected hooks %+v", hooks)
+		}
+
+		if _, err := ma.ExactMatch("missing"); err == nil {
+			t.Error("expected error for unknown package")
+		}
+	})
+
+	t.Run("corrupt index is rebuilt", func(t *testing.T) {
+		checksum, err := archiveChecksum(archivePath)
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		idxPath, _ := indexPaths(archivePath, checksum)
+		if err := os.WriteFile(idxPath, []byte("{corrupt"), 0644); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		ma := NewManifestArchive(archivePath)
+
+		if ma.index == nil || ma.Count != 3 {
+			t.Fatalf("expected rebuilt index with 3 packages, got %d", ma.Count)
+		}
+	})
+
+	t.Run("unchanged archive is not hashed again", func(t *testing.T) {
+		checksum, err := archiveChecksum(archivePath)
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if got, err := stampedChecksum(archivePath); err != nil || got != checksum {
+			t.Fatalf("expected %s, got %s, %v", checksum, got, err)
+		}
+
+		// A stamp matching size and modification time is trusted
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		writeStamp(archivePath, info, "recorded")
+		if got, _ := stampedChecksum(archivePath); got != "recorded" {
+			t.Errorf("expected the recorded checksum, got %s", got)
+		}
+
+		touched := info.ModTime().Add(time.Second)
+		if err := os.Chtimes(archivePath, touched, touched); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if got, _ := stampedChecksum(archivePath); got != checksum {
+			t.Errorf("expected %s after the archive changed, got %s", checksum, got)
+		}
+	})
+
+	t.Run("changed archive gets a new index", func(t *testing.T) {
+		writeManifestArchive(t, archivePath, "core", []schema.PackageManifest{
+			{Name: "jq", Exec: "jq"},
+		}, nil)
+
+		ma := NewManifestArchive(archivePath)
+
+		if ma.Count != 1 {
+			t.Errorf("expected 1 package after update, got %d", ma.Count)
+		}
+		if _, err := ma.ExactMatch("yq"); err == nil {
+			t.Error("expected yq to be gone after update")
+		}
+	})
+}
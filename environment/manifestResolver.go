@@ -0,0 +1,158 @@
+package environment
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arafat/please/schema"
+)
+
+// DefaultNamespace is assumed for installed packages that were recorded
+// before namespaces were tracked in env.json.
+const DefaultNamespace = "core"
+
+// ManifestResolver looks packages up across the manifest archives of all
+// configured sources, keyed by the namespace each archive declares.
+type ManifestResolver struct {
+	archives map[string]*ManifestArchive
+	// preferred is the configured default namespace, searched first
+	preferred string
+}
+
+func NewManifestResolver(e *Environment) (*ManifestResolver, error) {
+	paths, err := e.GetManifestPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ManifestResolver{archives: make(map[string]*ManifestArchive)}
+	if e.Config != nil {
+		r.preferred = e.Config.DefaultNamespace
+	}
+	for _, path := range paths {
+		ma := NewManifestArchive(path)
+		if ma.Namespace == "" {
+			continue
+		}
+		if existing, ok := r.archives[ma.Namespace]; ok {
+			return nil, fmt.Errorf("namespace %q is declared by both %s and %s", ma.Namespace, existing.Path, ma.Path)
+		}
+		r.archives[ma.Namespace] = ma
+	}
+
+	if len(r.archives) == 0 {
+		return nil, fmt.Errorf("no readable manifest archives found. Please run '$ please update'.")
+	}
+
+	return r, nil
+}
+
+// Namespaces returns the known namespaces, "core" first, then alphabetically.
+func (r *ManifestResolver) Namespaces() []string {
+	namespaces := make([]string, 0, len(r.archives))
+	for namespace := range r.archives {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		if namespaces[i] == DefaultNamespace {
+			return true
+		}
+		if namespaces[j] == DefaultNamespace {
+			return false
+		}
+		return namespaces[i] < namespaces[j]
+	})
+	return namespaces
+}
+
+// Archive returns the manifest archive of namespace.
+func (r *ManifestResolver) Archive(namespace string) (*ManifestArchive, error) {
+	ma, ok := r.archives[namespace]
+	if !ok {
+		return nil, fmt.Errorf("unknown namespace %q, available: %s", namespace, strings.Join(r.Namespaces(), ", "))
+	}
+	return ma, nil
+}
+
+// Resolve finds the manifest of pkg. An empty namespace searches the configured
+// default namespace first, then every archive, and fails if the package exists
+// in more than one namespace.
+func (r *ManifestResolver) Resolve(namespace, pkg string) (*ManifestArchive, *schema.PackageManifest, error) {
+	if namespace == "" && r.preferred != "" {
+		if ma, ok := r.archives[r.preferred]; ok {
+			if pm, err := ma.ExactMatch(pkg); err == nil {
+				return ma, pm, nil
+			}
+		}
+	}
+
+	if namespace != "" {
+		ma, err := r.Archive(namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		pm, err := ma.ExactMatch(pkg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+		return ma, pm, nil
+	}
+
+	var (
+		foundArchive  *ManifestArchive
+		foundManifest *schema.PackageManifest
+		found         []string
+	)
+	for _, ns := range r.Namespaces() {
+		ma := r.archives[ns]
+		pm, err := ma.ExactMatch(pkg)
+		if err != nil {
+			continue
+		}
+		if foundArchive == nil {
+			foundArchive, foundManifest = ma, pm
+		}
+		found = append(found, ns)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, nil, fmt.Errorf("package with name '%s' not found in any namespace", pkg)
+	case 1:
+		return foundArchive, foundManifest, nil
+	default:
+		return nil, nil, fmt.Errorf("package %q is ambiguous, it exists in namespaces %s; use <namespace>:%s",
+			pkg, strings.Join(found, ", "), pkg)
+	}
+}
+
+// Suggest returns the names of packages similar to pkg, the closest few of
+// every namespace.
+func (r *ManifestResolver) Suggest(pkg string) []string {
+	var suggestions []string
+	for _, ns := range r.Namespaces() {
+		manifests, err := r.archives[ns].FuzzySearch(pkg, 3)
+		if err != nil {
+			continue
+		}
+		for _, pm := range manifests {
+			if !slices.Contains(suggestions, pm.Name) {
+				suggestions = append(suggestions, pm.Name)
+			}
+		}
+	}
+	return suggestions
+}
+
+// ResolveInstalled finds the manifest of a package installed in bundleName
+// using the namespace recorded at install time.
+func (r *ManifestResolver) ResolveInstalled(b *Bundle, bundleName, pkg, version string) (*ManifestArchive, *schema.PackageManifest, error) {
+	namespace := b.GetPackageNamespace(bundleName, pkg, version)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return r.Resolve(namespace, pkg)
+}
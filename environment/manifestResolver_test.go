@@ -0,0 +1,160 @@
+package environment
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+// writeManifestArchive creates a manifest tarball the way manifest sources
+// publish them: a root JSON document plus optional hooks/ scripts.
+func writeManifestArchive(t *testing.T, path, namespace string, manifests []schema.PackageManifest, hooks map[string]string) {
+	t.Helper()
+
+	doc, err := json.Marshal(struct {
+		Namespace string                   `json:"namespace"`
+		Manifests []schema.PackageManifest `json:"manifests"`
+	}{namespace, manifests})
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	files := map[string]string{"manifest.json": string(doc)}
+	for name, script := range hooks {
+		files["hooks/"+name] = script
+	}
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+}
+
+func newTestResolver(t *testing.T) *ManifestResolver {
+	t.Helper()
+	tmpDir := t.TempDir()
+	e := &Environment{PleasePath: tmpDir, manifestPath: tmpDir}
+
+	writeManifestArchive(t, filepath.Join(tmpDir, "manifest-core.tar.gz"), "core", []schema.PackageManifest{
+		{Name: "jq", Image: "jq"},
+		{Name: "kubectl", Image: "bitnami/kubectl"},
+	}, nil)
+	writeManifestArchive(t, filepath.Join(tmpDir, "manifest-internal.tar.gz"), "internal", []schema.PackageManifest{
+		{Name: "kubectl", Image: "registry.internal/kubectl"},
+		{Name: "deployer", Image: "registry.internal/deployer"},
+	}, nil)
+
+	r, err := NewManifestResolver(e)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return r
+}
+
+func TestManifestResolverResolve(t *testing.T) {
+	r := newTestResolver(t)
+
+	t.Run("unique name", func(t *testing.T) {
+		ma, pm, err := r.Resolve("", "deployer")
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ma.Namespace != "internal" || pm.Name != "deployer" {
+			t.Errorf("expected internal:deployer, got %s:%s", ma.Namespace, pm.Name)
+		}
+	})
+
+	t.Run("explicit namespace", func(t *testing.T) {
+		_, pm, err := r.Resolve("internal", "kubectl")
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pm.Image != "registry.internal/kubectl" {
+			t.Errorf("expected internal image, got %s", pm.Image)
+		}
+	})
+
+	t.Run("ambiguous name", func(t *testing.T) {
+		_, _, err := r.Resolve("", "kubectl")
+
+		if err == nil || !strings.Contains(err.Error(), "core, internal") {
+			t.Fatalf("expected ambiguity error naming both namespaces, got %v", err)
+		}
+	})
+
+	t.Run("unknown namespace", func(t *testing.T) {
+		_, _, err := r.Resolve("missing", "jq")
+
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("configured default namespace wins", func(t *testing.T) {
+		preferred := *r
+		preferred.preferred = "internal"
+
+		ma, _, err := preferred.Resolve("", "kubectl")
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ma.Namespace != "internal" {
+			t.Errorf("expected internal, got %s", ma.Namespace)
+		}
+	})
+}
+
+func TestManifestResolverResolveInstalled(t *testing.T) {
+	r := newTestResolver(t)
+	b := &Bundle{
+		bDefs: &schema.BundleDefinitions{
+			Bundles: map[string]*schema.Bundle{
+				"dev": {Packages: map[string]string{"kubectl": "1.29.0"}},
+			},
+		},
+	}
+
+	_, pm, err := r.ResolveInstalled(b, "dev", "kubectl", "1.29.0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if pm.Image != "bitnami/kubectl" {
+		t.Errorf("expected unrecorded namespace to default to core, got %s", pm.Image)
+	}
+
+	b.SetPackageNamespace("dev", "kubectl", "1.29.0", "internal")
+	_, pm, err = r.ResolveInstalled(b, "dev", "kubectl", "1.29.0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if pm.Image != "registry.internal/kubectl" {
+		t.Errorf("expected recorded namespace to be used, got %s", pm.Image)
+	}
+}
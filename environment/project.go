@@ -0,0 +1,173 @@
+package environment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arafat/please/schema"
+)
+
+const (
+	ProjectFileName = ".please.json"
+	projectsDir     = "projects"
+)
+
+var ErrNoProjectFile = errors.New("no project file found")
+
+// FindProjectFile walks up from dir to the filesystem root and returns the
+// path of the first project file it encounters.
+func FindProjectFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		candidate := filepath.Join(dir, ProjectFileName)
+		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNoProjectFile
+		}
+		dir = parent
+	}
+}
+
+// LoadProject reads a project file. It uses the same format as a single
+// bundle entry in env.json.
+func LoadProject(path string) (*schema.Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project file: %w", err)
+	}
+
+	var project schema.Bundle
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal project file %s: %w", path, err)
+	}
+
+	if project.Packages == nil {
+		project.Packages = make(map[string]string)
+	}
+
+	return &project, nil
+}
+
+// ProjectBinPath returns the bin directory holding the shims of the project
+// declared by projectFile.
+func (e *Environment) ProjectBinPath(projectFile string) string {
+	sum := sha256.Sum256([]byte(projectFile))
+	return filepath.Join(e.PleasePath, projectsDir, hex.EncodeToString(sum[:8]), "bin")
+}
+
+// InstalledExecutables lists the executables deployed for pkg in version.
+func (e *Environment) InstalledExecutables(pkg, version string) ([]string, error) {
+	if err := ValidatePackageName(pkg); err != nil {
+		return nil, err
+	}
+	if err := ValidateVersion(version); err != nil {
+		return nil, fmt.Errorf("package %q: %w", pkg, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(e.VersionsPath, pkg, version))
+	if err != nil {
+		return nil, err
+	}
+
+	var executables []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sh") {
+			executables = append(executables, strings.TrimSuffix(entry.Name(), ".sh"))
+		}
+	}
+	return executables, nil
+}
+
+// LinkProject (re)creates the project bin directory so that it contains a
+// symlink for every package of the project that is available in the versions
+// directory. The project file comes with the repository, so its entries are
+// validated like user input. Packages whose version has not been installed
+// yet are returned as "pkg:version" in missing, entries that were not linked
+// for another reason are described in skipped.
+func (e *Environment) LinkProject(projectFile string, project *schema.Bundle) (binPath string, missing, skipped []string, err error) {
+	packages := make(map[string][]string, len(project.Packages))
+	for pkg, version := range project.Packages {
+		packages[pkg] = []string{version}
+	}
+
+	binPath = e.ProjectBinPath(projectFile)
+	missing, skipped, err = e.linkGeneration(binPath, "project-", packages)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return binPath, missing, skipped, nil
+}
+
+// linkPackages symlinks the executables of packages into binPath: those of the
+// first, default, version of each package under their name and every version
+// as <executable>@<version>. Versions that are not installed are returned as
+// "pkg:version", invalid package names and versions are never linked and are
+// described in skipped. If packages provide the same executable, the first
+// package in name order keeps it and the conflict is described in skipped.
+func (e *Environment) linkPackages(binPath string, packages map[string][]string) (missing, skipped []string, err error) {
+	pkgs := make([]string, 0, len(packages))
+	for pkg := range packages {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	// linked maps the names in binPath to the pkg:version providing them
+	linked := make(map[string]string)
+	for _, pkg := range pkgs {
+		if err := ValidatePackageName(pkg); err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		for i, version := range packages[pkg] {
+			if err := ValidateVersion(version); err != nil {
+				skipped = append(skipped, fmt.Sprintf("package %q: %v", pkg, err))
+				continue
+			}
+
+			executables, err := e.InstalledExecutables(pkg, version)
+			if err == nil && len(executables) == 0 && e.IsService(pkg, version) {
+				// Service packages have no executable, please service runs them
+				continue
+			}
+			if err != nil || len(executables) == 0 {
+				missing = append(missing, fmt.Sprintf("%s:%s", pkg, version))
+				continue
+			}
+
+			for _, executable := range executables {
+				targetPath := filepath.Join(e.VersionsPath, pkg, version, executable+".sh")
+				names := []string{executable + "@" + version}
+				if i == 0 {
+					names = append(names, executable)
+				}
+				for _, name := range names {
+					if owner, ok := linked[name]; ok {
+						skipped = append(skipped, fmt.Sprintf("package %q: executable %q is already linked from %s", pkg, name, owner))
+						continue
+					}
+					linked[name] = fmt.Sprintf("%s:%s", pkg, version)
+					if err := os.Symlink(targetPath, filepath.Join(binPath, name)); err != nil {
+						return nil, nil, fmt.Errorf("failed to create symlink for %s: %w", name, err)
+					}
+				}
+			}
+		}
+	}
+
+	return missing, skipped, nil
+}
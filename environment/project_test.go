@@ -0,0 +1,194 @@
+package environment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arafat/please/schema"
+)
+
+func TestFindProjectFile(t *testing.T) {
+	t.Run("found in parent", func(t *testing.T) {
+		root := t.TempDir()
+		projectFile := filepath.Join(root, ProjectFileName)
+		if err := os.WriteFile(projectFile, []byte(`{"packages":{}}`), 0644); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		nested := filepath.Join(root, "a", "b")
+		if err := os.MkdirAll(nested, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		found, err := FindProjectFile(nested)
+
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found != projectFile {
+			t.Errorf("expected %s, got %s", projectFile, found)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := FindProjectFile(t.TempDir())
+
+		if !errors.Is(err, ErrNoProjectFile) {
+			t.Fatalf("expected ErrNoProjectFile, got %v", err)
+		}
+	})
+}
+
+func TestLinkProject(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:   tmpDir,
+		VersionsPath: filepath.Join(tmpDir, "versions"),
+	}
+
+	installed := filepath.Join(e.VersionsPath, "kubectl", "1.29.0")
+	if err := os.MkdirAll(installed, 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(installed, "kubectl.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	project := &schema.Bundle{
+		Packages: map[string]string{"kubectl": "1.29.0", "jq": "1.7"},
+	}
+	projectFile := filepath.Join(tmpDir, "repo", ProjectFileName)
+
+	binPath, missing, _, err := e.LinkProject(projectFile, project)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(missing) != 1 || missing[0] != "jq:1.7" {
+		t.Errorf("expected [jq:1.7] missing, got %v", missing)
+	}
+	target, err := os.Readlink(filepath.Join(binPath, "kubectl"))
+	if err != nil {
+		t.Fatalf("expected kubectl symlink, got %v", err)
+	}
+	if target != filepath.Join(installed, "kubectl.sh") {
+		t.Errorf("unexpected symlink target %s", target)
+	}
+}
+
+func TestLinkProjectInvalidEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:   tmpDir,
+		VersionsPath: filepath.Join(tmpDir, "versions"),
+	}
+
+	// A repository shipping its own script next to the versions directory
+	script := filepath.Join(tmpDir, "repo", "evil")
+	if err := os.MkdirAll(script, 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(script, "ls.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	project := &schema.Bundle{
+		Packages: map[string]string{"../repo": "evil", "jq": "../../repo/evil"},
+	}
+	projectFile := filepath.Join(tmpDir, "repo", ProjectFileName)
+
+	binPath, missing, skipped, err := e.LinkProject(projectFile, project)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("expected nothing missing, got %v", missing)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected 2 skipped entries, got %v", skipped)
+	}
+	entries, err := os.ReadDir(binPath)
+	if err != nil {
+		t.Fatalf("expected bin directory, got %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no links, got %d", len(entries))
+	}
+}
+
+func TestLinkProjectReplacesBin(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:   tmpDir,
+		VersionsPath: filepath.Join(tmpDir, "versions"),
+	}
+	projectFile := filepath.Join(tmpDir, "repo", ProjectFileName)
+
+	// A bin directory linked before the switch was atomic
+	binPath := e.ProjectBinPath(projectFile)
+	if err := os.MkdirAll(binPath, 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := os.Symlink("/nowhere", filepath.Join(binPath, "stale")); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	project := &schema.Bundle{Packages: map[string]string{}}
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := e.LinkProject(projectFile, project); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(binPath, "stale")); !os.IsNotExist(err) {
+		t.Errorf("expected stale link to be removed, got %v", err)
+	}
+	generations, err := os.ReadDir(filepath.Join(tmpDir, generationsDir))
+	if err != nil {
+		t.Fatalf("expected generations directory, got %v", err)
+	}
+	if len(generations) != 1 {
+		t.Errorf("expected 1 generation, got %d", len(generations))
+	}
+}
+
+func TestLinkProjectConflictingExecutables(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{
+		PleasePath:   tmpDir,
+		VersionsPath: filepath.Join(tmpDir, "versions"),
+	}
+
+	for _, pkg := range []string{"python", "python-slim"} {
+		installed := filepath.Join(e.VersionsPath, pkg, "3.12")
+		if err := os.MkdirAll(installed, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installed, "python3.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	project := &schema.Bundle{
+		Packages: map[string]string{"python-slim": "3.12", "python": "3.12"},
+	}
+	projectFile := filepath.Join(tmpDir, "repo", ProjectFileName)
+
+	binPath, _, skipped, err := e.LinkProject(projectFile, project)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected python3 and python3@3.12 skipped, got %v", skipped)
+	}
+	target, err := os.Readlink(filepath.Join(binPath, "python3"))
+	if err != nil {
+		t.Fatalf("expected python3 symlink, got %v", err)
+	}
+	if expected := filepath.Join(e.VersionsPath, "python", "3.12", "python3.sh"); target != expected {
+		t.Errorf("expected %s, got %s", expected, target)
+	}
+}
@@ -0,0 +1,168 @@
+package environment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arafat/please/artifacts"
+	"github.com/arafat/please/schema"
+)
+
+const (
+	servicesFile          = "services.json"
+	serviceDefinitionFile = "service.json"
+)
+
+// Services records the service containers please started, per bundle.
+type Services struct {
+	path     string
+	services *schema.Services
+}
+
+// ServicesPath returns the file recording the started services.
+func (e *Environment) ServicesPath() string {
+	return filepath.Join(e.PleasePath, servicesFile)
+}
+
+// containerNameRegexp matches the container and volume names runtimes accept.
+var containerNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// ServiceContainerName returns the name of the container running pkg for
+// bundleName, so that each bundle can run its own version of a service.
+// Bundle and package names may contain dashes themselves, a hash of both
+// keeps the names of a-b/c and a/b-c apart.
+func ServiceContainerName(bundleName, pkg string) (string, error) {
+	return serviceName(bundleName, pkg)
+}
+
+// ServiceVolume maps the named volume name:/path of a service package to a
+// volume of its own for bundleName.
+func ServiceVolume(bundleName, pkg, volume string) (string, error) {
+	name, path, _ := strings.Cut(volume, ":")
+	volumeName, err := serviceName(bundleName, pkg, name)
+	if err != nil {
+		return "", err
+	}
+	return volumeName + ":" + path, nil
+}
+
+// serviceName joins parts and their hash into a container or volume name.
+func serviceName(parts ...string) (string, error) {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	name := "please-" + strings.Join(parts, "-") + "-" + hex.EncodeToString(sum[:6])
+	if !containerNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid service name %q", name)
+	}
+	return name, nil
+}
+
+// LoadServices reads the started services, none if the file does not exist.
+func LoadServices(e *Environment) (*Services, error) {
+	s := &Services{path: e.ServicesPath(), services: &schema.Services{}}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read services: %w", err)
+	}
+	if err := json.Unmarshal(data, s.services); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal services: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Services) Save() error {
+	data, err := json.MarshalIndent(s.services, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal services: %w", err)
+	}
+	return writeFileAtomic(s.path, data, 0644)
+}
+
+// Get returns the service pkg started for bundleName, or nil.
+func (s *Services) Get(bundleName, pkg string) *schema.Service {
+	for _, svc := range s.services.Services {
+		if svc.Bundle == bundleName && svc.Package == pkg {
+			return svc
+		}
+	}
+	return nil
+}
+
+// Put records svc, replacing the one of the same bundle and package.
+func (s *Services) Put(svc *schema.Service) {
+	s.Remove(svc.Bundle, svc.Package)
+	s.services.Services = append(s.services.Services, svc)
+}
+
+// Remove forgets the service pkg of bundleName.
+func (s *Services) Remove(bundleName, pkg string) {
+	kept := s.services.Services[:0]
+	for _, svc := range s.services.Services {
+		if svc.Bundle != bundleName || svc.Package != pkg {
+			kept = append(kept, svc)
+		}
+	}
+	s.services.Services = kept
+}
+
+// Using returns the started services running pkg:version, in any bundle.
+func (s *Services) Using(pkg, version string) []*schema.Service {
+	var services []*schema.Service
+	for _, svc := range s.List("") {
+		if svc.Package == pkg && svc.Version == version {
+			services = append(services, svc)
+		}
+	}
+	return services
+}
+
+// List returns the services of bundleName, or of every bundle if it is empty,
+// sorted by bundle and package.
+func (s *Services) List(bundleName string) []*schema.Service {
+	var services []*schema.Service
+	for _, svc := range s.services.Services {
+		if bundleName == "" || svc.Bundle == bundleName {
+			services = append(services, svc)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Bundle != services[j].Bundle {
+			return services[i].Bundle < services[j].Bundle
+		}
+		return services[i].Package < services[j].Package
+	})
+	return services
+}
+
+// ServiceDefinitionPath returns where the service definition of pkg:version
+// is deployed.
+func (e *Environment) ServiceDefinitionPath(pkg, version string) string {
+	return filepath.Join(e.VersionsPath, pkg, version, serviceDefinitionFile)
+}
+
+// DeployService deploys the service definition of pkg:version, what a service
+// package installs instead of a shim.
+func (e *Environment) DeployService(d *artifacts.ServiceDefinition, pkg, version string) error {
+	if err := os.MkdirAll(filepath.Dir(e.ServiceDefinitionPath(pkg, version)), 0755); err != nil {
+		return fmt.Errorf("Error creating directories:%w", err)
+	}
+	if err := d.Deploy(e.ServiceDefinitionPath(pkg, version)); err != nil {
+		return fmt.Errorf("failed to deploy service: %w", err)
+	}
+	return nil
+}
+
+// IsService reports whether pkg:version is an installed service package.
+func (e *Environment) IsService(pkg, version string) bool {
+	_, err := os.Stat(e.ServiceDefinitionPath(pkg, version))
+	return err == nil
+}
@@ -0,0 +1,136 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arafat/please/artifacts"
+	"github.com/arafat/please/schema"
+)
+
+func TestServices(t *testing.T) {
+	tmpDir := t.TempDir()
+	e := &Environment{PleasePath: tmpDir, VersionsPath: filepath.Join(tmpDir, "versions")}
+
+	services, err := LoadServices(e)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if list := services.List(""); len(list) != 0 {
+		t.Fatalf("expected no services, got %v", list)
+	}
+
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	services.Put(&schema.Service{Bundle: "dev", Package: "redis", Version: "7.2", Started: started})
+	services.Put(&schema.Service{Bundle: "dev", Package: "postgres", Version: "15", Started: started})
+	services.Put(&schema.Service{Bundle: "default", Package: "postgres", Version: "16", Started: started})
+	// Restarting with another version replaces the record
+	services.Put(&schema.Service{Bundle: "dev", Package: "postgres", Version: "16", Started: started})
+	if err := services.Save(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("saved per bundle", func(t *testing.T) {
+		loaded, err := LoadServices(e)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var got []string
+		for _, svc := range loaded.List("") {
+			got = append(got, svc.Bundle+"/"+svc.Package+":"+svc.Version)
+		}
+		expected := []string{"default/postgres:16", "dev/postgres:16", "dev/redis:7.2"}
+		if len(got) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("expected %v, got %v", expected, got)
+				break
+			}
+		}
+
+		if list := loaded.List("dev"); len(list) != 2 {
+			t.Errorf("expected 2 services in dev, got %d", len(list))
+		}
+		if svc := loaded.Get("default", "postgres"); svc == nil || !svc.Started.Equal(started) {
+			t.Errorf("expected default/postgres started at %v, got %+v", started, svc)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		services.Remove("dev", "redis")
+		if svc := services.Get("dev", "redis"); svc != nil {
+			t.Errorf("expected dev/redis to be removed, got %+v", svc)
+		}
+		if svc := services.Get("dev", "postgres"); svc == nil {
+			t.Error("expected dev/postgres to be kept")
+		}
+	})
+
+	t.Run("names are per bundle", func(t *testing.T) {
+		name, err := ServiceContainerName("dev", "postgres")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(name, "please-dev-postgres-") {
+			t.Errorf("expected please-dev-postgres-<hash>, got %s", name)
+		}
+		volume, err := ServiceVolume("dev", "postgres", "data:/var/lib/postgresql/data")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(volume, "please-dev-postgres-data-") || !strings.HasSuffix(volume, ":/var/lib/postgresql/data") {
+			t.Errorf("expected please-dev-postgres-data-<hash>:/var/lib/postgresql/data, got %s", volume)
+		}
+
+		// Dashes in bundle and package names do not collide
+		a, _ := ServiceContainerName("a-b", "c")
+		b, _ := ServiceContainerName("a", "b-c")
+		if a == b {
+			t.Errorf("expected different names, got %s twice", a)
+		}
+		if _, err := ServiceContainerName("dev", "my/pkg"); err == nil {
+			t.Error("expected error for an invalid name, got nil")
+		}
+	})
+
+	t.Run("services keep their versions", func(t *testing.T) {
+		if using := services.Using("postgres", "16"); len(using) != 2 {
+			t.Errorf("expected postgres:16 in 2 bundles, got %d", len(using))
+		}
+		references, err := e.ArtifactReferences(&Bundle{bDefs: &schema.BundleDefinitions{}}, Artifact{"postgres", "16"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(references) != 2 || references[0] != "service" {
+			t.Errorf("expected two service references, got %v", references)
+		}
+	})
+
+	t.Run("service packages are not missing", func(t *testing.T) {
+		def := &artifacts.ServiceDefinition{Image: "redis", Version: "7.2"}
+		if err := e.DeployService(def, "redis", "7.2"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !e.IsService("redis", "7.2") {
+			t.Fatal("expected redis:7.2 to be a service")
+		}
+
+		binPath := filepath.Join(tmpDir, "bin")
+		if err := os.MkdirAll(binPath, 0755); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		missing, _, err := e.linkPackages(binPath, map[string][]string{"redis": {"7.2"}, "jq": {"1.7"}})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(missing) != 1 || missing[0] != "jq:1.7" {
+			t.Errorf("expected [jq:1.7], got %v", missing)
+		}
+	})
+}
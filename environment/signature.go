@@ -0,0 +1,85 @@
+package environment
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// signatureSuffix is appended to a source URL to locate its detached signature.
+const signatureSuffix = ".sig"
+
+// ManifestSignature is the detached, signed metadata published next to a
+// manifest archive.
+type ManifestSignature struct {
+	Version   int64     `json:"version"`
+	Expires   time.Time `json:"expires"`
+	SHA256    string    `json:"sha256"`
+	Signature string    `json:"signature"`
+}
+
+// SignedPayload returns the bytes covered by the signature.
+func (s *ManifestSignature) SignedPayload() []byte {
+	return fmt.Appendf(nil, "please-manifest-v1\n%s\n%d\n%s\n", s.SHA256, s.Version, s.Expires.UTC().Format(time.RFC3339))
+}
+
+// Verify checks the signature against the archive checksum, the trusted keys,
+// the expiry date and the version of the currently installed archive.
+func (s *ManifestSignature) Verify(checksum string, keys []ed25519.PublicKey, installedVersion int64, now time.Time) error {
+	if s.SHA256 != checksum {
+		return fmt.Errorf("archive checksum %s does not match signed checksum %s", checksum, s.SHA256)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	verified := false
+	for _, key := range keys {
+		if ed25519.Verify(key, s.SignedPayload(), sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return fmt.Errorf("signature does not match any trusted key")
+	}
+
+	if !now.Before(s.Expires) {
+		return fmt.Errorf("signed metadata expired at %s", s.Expires.Format(time.RFC3339))
+	}
+
+	if s.Version < installedVersion {
+		return fmt.Errorf("version %d is older than installed version %d", s.Version, installedVersion)
+	}
+
+	return nil
+}
+
+func fetchManifestSignature(client *http.Client, url string) (*ManifestSignature, error) {
+	resp, err := client.Get(url + signatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("Error downloading signature: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s for signature", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Error downloading signature: %w", err)
+	}
+
+	var sig ManifestSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signature: %w", err)
+	}
+	return &sig, nil
+}
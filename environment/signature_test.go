@@ -0,0 +1,115 @@
+package environment
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arafat/please/schema"
+)
+
+func signManifest(t *testing.T, priv ed25519.PrivateKey, archivePath string, version int64, expires time.Time) []byte {
+	t.Helper()
+	checksum, err := archiveChecksum(archivePath)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	sig := &ManifestSignature{Version: version, Expires: expires, SHA256: checksum}
+	sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, sig.SignedPayload()))
+	data, err := json.Marshal(sig)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return data
+}
+
+func TestManifestSignatureVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sig := &ManifestSignature{Version: 5, Expires: now.Add(24 * time.Hour), SHA256: "abc"}
+	sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, sig.SignedPayload()))
+
+	tests := []struct {
+		name      string
+		checksum  string
+		keys      []ed25519.PublicKey
+		installed int64
+		now       time.Time
+		wantErr   bool
+	}{
+		{"valid", "abc", []ed25519.PublicKey{otherPub, pub}, 4, now, false},
+		{"tampered archive", "def", []ed25519.PublicKey{pub}, 0, now, true},
+		{"untrusted key", "abc", []ed25519.PublicKey{otherPub}, 0, now, true},
+		{"expired", "abc", []ed25519.PublicKey{pub}, 0, now.Add(48 * time.Hour), true},
+		{"rollback", "abc", []ed25519.PublicKey{pub}, 6, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sig.Verify(tt.checksum, tt.keys, tt.installed, tt.now)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDownloadSignedManifest(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "source.tar.gz")
+	writeManifestArchive(t, archive, "core", []schema.PackageManifest{{Name: "jq"}}, nil)
+	body, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	var signature []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filepath.Ext(r.URL.Path) == signatureSuffix {
+			w.Write(signature)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	e := &Environment{PleasePath: tmpDir, manifestPath: tmpDir}
+	ts := &TrustStore{Keys: map[string][]string{}}
+	if err := ts.Trust(AllSources, base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := ts.Save(e); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	url := server.URL + "/manifest-core.tar.gz"
+
+	signature = signManifest(t, priv, archive, 2, time.Now().Add(time.Hour))
+	results, err := e.DownloadManifestFiles([]string{url})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !results[0].Verified {
+		t.Error("expected download to be verified")
+	}
+
+	signature = signManifest(t, priv, archive, 1, time.Now().Add(time.Hour))
+	if _, err := e.DownloadManifestFiles([]string{url}); err == nil {
+		t.Error("expected older archive version to be rejected")
+	}
+
+	signature = []byte(`{}`)
+	if _, err := e.DownloadManifestFiles([]string{url}); err == nil {
+		t.Error("expected unsigned archive to be rejected")
+	}
+}
@@ -0,0 +1,114 @@
+package environment
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const (
+	trustFile = "trust.json"
+	// AllSources is the trust store key for keys trusted for every source.
+	AllSources = "*"
+)
+
+// TrustStore holds the base64 encoded ed25519 public keys trusted to sign the
+// manifest archives of each source.
+type TrustStore struct {
+	Keys map[string][]string `json:"keys"`
+}
+
+func (e *Environment) TrustStorePath() string {
+	return filepath.Join(e.PleasePath, trustFile)
+}
+
+func LoadTrustStore(e *Environment) (*TrustStore, error) {
+	ts := &TrustStore{Keys: make(map[string][]string)}
+
+	data, err := os.ReadFile(e.TrustStorePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, ts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trust store: %w", err)
+	}
+	if ts.Keys == nil {
+		ts.Keys = make(map[string][]string)
+	}
+	return ts, nil
+}
+
+func (ts *TrustStore) Save(e *Environment) error {
+	data, err := json.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trust store: %w", err)
+	}
+
+	if err := os.WriteFile(e.TrustStorePath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// ParsePublicKey decodes a base64 encoded ed25519 public key.
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encoding: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid key length %d, expected %d bytes", len(raw), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Trust adds key to the keys trusted for source.
+func (ts *TrustStore) Trust(source, key string) error {
+	if _, err := ParsePublicKey(key); err != nil {
+		return err
+	}
+	if slices.Contains(ts.Keys[source], key) {
+		return fmt.Errorf("key is already trusted for %s", source)
+	}
+
+	ts.Keys[source] = append(ts.Keys[source], key)
+	return nil
+}
+
+// Untrust removes key from the keys trusted for source.
+func (ts *TrustStore) Untrust(source, key string) error {
+	keys := ts.Keys[source]
+	i := slices.Index(keys, key)
+	if i < 0 {
+		return fmt.Errorf("key is not trusted for %s", source)
+	}
+
+	ts.Keys[source] = slices.Delete(keys, i, i+1)
+	if len(ts.Keys[source]) == 0 {
+		delete(ts.Keys, source)
+	}
+	return nil
+}
+
+// KeysFor returns the keys trusted for source, including keys trusted for
+// all sources.
+func (ts *TrustStore) KeysFor(source string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, encoded := range append(slices.Clone(ts.Keys[AllSources]), ts.Keys[source]...) {
+		key, err := ParsePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("trust store entry for %s: %w", source, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -5,9 +5,27 @@ type BundleDefinitions struct {
 	ActiveBundle string             `json:"activeEnvironment"`
 }
 
+// Bundle is a named set of packages. Extends names bundles whose packages it
+// inherits, a package of the bundle itself or of a later parent overrides
+// the same package of an earlier one.
 type Bundle struct {
 	Description string            `json:"description"`
+	Extends     []string          `json:"extends,omitempty"`
 	Packages    map[string]string `json:"packages"`
+	// Versions lists further versions of a package installed next to the
+	// default one in Packages, each linked as <exec>@<version>
+	Versions map[string][]string     `json:"versions,omitempty"`
+	Lock     map[string]*PackageLock `json:"lock,omitempty"`
+}
+
+// PackageLock records where an installed package version came from and pins
+// it to an image digest, keyed by "<pkg>:<version>". Constraint is the version
+// constraint the package was installed with; without one the version is a pin
+// that upgrades leave alone.
+type PackageLock struct {
+	Namespace  string `json:"namespace,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
 }
 
 func NewDefaultBundle() *BundleDefinitions {
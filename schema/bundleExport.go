@@ -0,0 +1,27 @@
+package schema
+
+// BundleExportFormat is the version of the bundle export document, raised on
+// incompatible changes.
+const BundleExportFormat = 2
+
+// BundleExport is a self-contained description of a bundle written by please
+// bundle export and read by please bundle import.
+type BundleExport struct {
+	Format      int               `json:"format"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Packages    []ExportedPackage `json:"packages"`
+}
+
+// ExportedPackage is a version of a package of an exported bundle, listed
+// once per version. Default marks the version the package runs by default,
+// format 1 exports list one version per package and leave it out. An empty
+// Constraint means the version is pinned, as in PackageLock.
+type ExportedPackage struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Default    bool   `json:"default,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+}
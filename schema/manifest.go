@@ -15,14 +15,27 @@ type PackageManifest struct {
 	Versions         []string          `json:"versions,omitempty"`
 	VersionDiscovery *VersionDiscovery `json:"version_discovery,omitempty"`
 
+	// LTS is a version constraint selecting the long-term support line,
+	// e.g. "^20". Installing "lts" falls back to DefaultVersion without it.
+	LTS string `json:"lts,omitempty"`
+
 	DefaultVersion  string            `json:"default_version"`
 	Script          string            `json:"script"`
 	Platforms       []string          `json:"platforms"`
 	ApplicationArgs []string          `json:"application_args"`
 	HostEnvVars     map[string]string `json:"host_env_vars"`
 	ContainerArgs   ContainerArgs     `json:"container_args"`
+	// Service configures the container of a package with script "service".
+	Service ServiceArgs `json:"service"`
 }
 
+// Script types of a manifest: a shim running a CLI tool once per call, or a
+// long running container controlled with please service.
+const (
+	ScriptStandard = "standard"
+	ScriptService  = "service"
+)
+
 // ContainerArgs maps directly to the container_args JSON object.
 type ContainerArgs struct {
 	DNS              []string          `json:"dns"`
@@ -30,6 +43,34 @@ type ContainerArgs struct {
 	Volumes          []string          `json:"volumes"`
 	AdditionalFlags  []string          `json:"additional_flags"`
 	ContainerEnvVars map[string]string `json:"container_env_vars"`
+	// TTY decides whether the container gets a terminal: always, never, or
+	// auto (the default) when the shim's stdin and stdout are terminals.
+	TTY string `json:"tty,omitempty"`
+}
+
+const (
+	TTYAlways = "always"
+	TTYNever  = "never"
+	TTYAuto   = "auto"
+)
+
+// ServiceArgs maps to the service JSON object of a service package.
+type ServiceArgs struct {
+	// Ports are published as host:container, e.g. "5432:5432".
+	Ports []string `json:"ports"`
+	// Volumes are named volumes as name:/path, kept per bundle.
+	Volumes     []string     `json:"volumes"`
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	// Restart is the runtime's restart policy, e.g. unless-stopped.
+	Restart string `json:"restart,omitempty"`
+}
+
+// HealthCheck is run inside a service container to report its health.
+type HealthCheck struct {
+	Command  string `json:"command"`
+	Interval string `json:"interval,omitempty"` // e.g. "10s"
+	Timeout  string `json:"timeout,omitempty"`
+	Retries  int    `json:"retries,omitempty"`
 }
 
 // VersionFilter defines the pattern and exclude rules for version discovery.
@@ -0,0 +1,20 @@
+package schema
+
+import "time"
+
+// Services is the content of services.json, the service containers please
+// started.
+type Services struct {
+	Services []*Service `json:"services"`
+}
+
+// Service is a service package started in a bundle.
+type Service struct {
+	Bundle    string    `json:"bundle"`
+	Package   string    `json:"package"`
+	Version   string    `json:"version"`
+	Container string    `json:"container"`
+	Image     string    `json:"image"`
+	Ports     []string  `json:"ports,omitempty"`
+	Started   time.Time `json:"started"`
+}
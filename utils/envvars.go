@@ -1,10 +1,15 @@
 package utils
 
 import (
+	"regexp"
 	"runtime"
 	"strings"
 )
 
+// hostVariable matches a variable reference at the start of a string, $NAME
+// or ${NAME}
+var hostVariable = regexp.MustCompile(`^\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)\})`)
+
 // Replaces ${RUNTIME_*} dynamically with according runtime data
 func MakeRuntimeReplacer(version string) func(map[string]string) {
 	replacements := map[string]string{
@@ -23,3 +28,33 @@ func MakeRuntimeReplacer(version string) func(map[string]string) {
 		}
 	}
 }
+
+// ExpandHostVars expands the host references manifests use in paths: $NAME,
+// ${NAME} and a leading ~ for HOME. variable returns what a reference to name
+// becomes and literal what the text between references does, so that shims
+// can leave the expansion to bash while services expand right away. Other
+// uses of $, e.g. $(cmd) or ${NAME:-x}, are literal text.
+func ExpandHostVars(s string, variable, literal func(string) string) string {
+	var b strings.Builder
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		b.WriteString(variable("HOME"))
+		s = s[1:]
+	}
+
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			continue
+		}
+		m := hostVariable.FindStringSubmatch(s[i:])
+		if m == nil {
+			continue
+		}
+		b.WriteString(literal(s[start:i]))
+		b.WriteString(variable(m[1] + m[2]))
+		i += len(m[0]) - 1
+		start = i + 1
+	}
+	b.WriteString(literal(s[start:]))
+	return b.String()
+}
@@ -0,0 +1,209 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Latest matches the newest stable version.
+const Latest = "latest"
+
+// comparator is a single operator and version, e.g. >=1.29.0.
+type comparator struct {
+	op      string
+	version Version
+}
+
+// Constraint is a set of alternatives separated by ||, each of which is a
+// space separated list of comparators that all have to match.
+type Constraint struct {
+	raw          string
+	alternatives [][]comparator
+	variants     []string
+	prerelease   bool
+}
+
+// IsConstraint reports whether s is a constraint rather than a literal tag.
+// Literal tags such as 1.29.0, 3 or 20-bookworm are used verbatim.
+func IsConstraint(s string) bool {
+	if s == Latest || s == "*" {
+		return true
+	}
+	if strings.ContainsAny(s, "^~<>=|* ") {
+		return true
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "x" || part == "X" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseConstraint parses constraints such as latest, ^1.29, ~3.11, 1.x,
+// >=1.2 <2 or ^1 || ^2.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: s}
+	s = strings.TrimSpace(s)
+	if s == "" || s == Latest || s == "*" {
+		c.alternatives = [][]comparator{{}}
+		c.variants = []string{""}
+		return c, nil
+	}
+
+	for _, alternative := range strings.Split(s, "||") {
+		var comparators []comparator
+		variant := ""
+		for _, term := range strings.Fields(alternative) {
+			parsed, err := parseTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			for _, p := range parsed {
+				if p.version.IsPrerelease() {
+					c.prerelease = true
+				}
+				if p.version.Variant != "" {
+					variant = p.version.Variant
+				}
+			}
+			comparators = append(comparators, parsed...)
+		}
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: empty alternative", s)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+		c.variants = append(c.variants, variant)
+	}
+
+	return c, nil
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
+
+// parseTerm expands a single term into comparators. Partial versions are
+// padded, so ~3.11 becomes >=3.11.0 <3.12.0.
+func parseTerm(term string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			term = strings.TrimPrefix(term, candidate)
+			break
+		}
+	}
+
+	// Trim wildcards: 1.x and 1.* are the same as the partial version 1
+	parts := strings.Split(strings.TrimPrefix(term, "v"), ".")
+	for len(parts) > 0 && (parts[len(parts)-1] == "x" || parts[len(parts)-1] == "X" || parts[len(parts)-1] == "*") {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 0 {
+		return []comparator{}, nil
+	}
+
+	v, err := Parse(strings.Join(parts, "."))
+	if err != nil {
+		return nil, err
+	}
+	precision := len(v.Numbers)
+
+	switch op {
+	case ">=", "<=", ">", "<":
+		return []comparator{{op, v}}, nil
+	case "^":
+		// Bump the first non-zero component, ^0.3 allows 0.3.x only
+		i := 0
+		for i < precision-1 && v.number(i) == 0 {
+			i++
+		}
+		return []comparator{{">=", v}, {"<", bump(v, i)}}, nil
+	case "~":
+		// ~3.11 and ~3.11.4 allow 3.11.x, ~3 allows 3.x
+		return []comparator{{">=", v}, {"<", bump(v, min(1, precision-1))}}, nil
+	default:
+		if op == "=" || precision >= 3 || v.IsPrerelease() {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", bump(v, precision-1)}}, nil
+	}
+}
+
+// bump returns the lowest version above v whose first i+1 components differ.
+func bump(v Version, i int) Version {
+	numbers := make([]int, i+1)
+	for j := 0; j < i; j++ {
+		numbers[j] = v.number(j)
+	}
+	numbers[i] = v.number(i) + 1
+	return Version{Numbers: numbers}
+}
+
+// Check reports whether v satisfies the constraint. Prereleases only match
+// constraints that mention a prerelease themselves, and variants such as
+// -alpine only match alternatives that name the same variant, so ^16 never
+// picks 16.2-alpine.
+func (c *Constraint) Check(v Version) bool {
+	if v.IsPrerelease() && !c.prerelease {
+		return false
+	}
+
+	for i, comparators := range c.alternatives {
+		if v.Variant != c.variants[i] {
+			continue
+		}
+		matches := true
+		for _, cmp := range comparators {
+			if !cmp.check(v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp comparator) check(v Version) bool {
+	c := v.Compare(cmp.version)
+	switch cmp.op {
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	default:
+		return c == 0
+	}
+}
+
+// Resolve returns the highest of the available tags satisfying constraint.
+func Resolve(constraint string, available []string) (string, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	best := ""
+	for _, tag := range available {
+		v, err := Parse(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if best == "" || Compare(tag, best) > 0 {
+			best = tag
+		}
+	}
+
+	if best == "" {
+		return "", fmt.Errorf("no version matches %q", constraint)
+	}
+	return best, nil
+}
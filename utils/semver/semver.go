@@ -0,0 +1,190 @@
+// Package semver orders container image tags as versions and matches them
+// against version constraints such as ^1.29 or ~3.11.
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed image tag. Tags like 20.9-bookworm carry a variant
+// that is ignored for ordering and constraint matching.
+type Version struct {
+	Original   string
+	Numbers    []int
+	Prerelease string
+	Variant    string
+	Build      string
+}
+
+var (
+	coreRegexp       = regexp.MustCompile(`^(\d+(?:\.\d+)*)(.*)$`)
+	prereleaseRegexp = regexp.MustCompile(`^(?i)(alpha|beta|rc|pre|preview|dev|snapshot|nightly|a|b)[.\d]*$`)
+	numericRegexp    = regexp.MustCompile(`^\d+$`)
+)
+
+// Parse parses tags such as 1.2.3, v1.29, 1.2.3-rc1, 3.12.1-alpine3.19 or
+// 1.2.3+build.5.
+func Parse(s string) (Version, error) {
+	v := Version{Original: s}
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	rest, v.Build, _ = strings.Cut(rest, "+")
+
+	m := coreRegexp.FindStringSubmatch(rest)
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	for _, part := range strings.Split(m[1], ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		v.Numbers = append(v.Numbers, n)
+	}
+
+	suffix := m[2]
+	if suffix == "" {
+		return v, nil
+	}
+
+	// 1.2.3rc1 is a prerelease, 1.2.3-alpine a variant
+	if !strings.ContainsAny(suffix[:1], "-._") {
+		suffix = "-" + suffix
+	}
+	tokens := strings.Split(strings.TrimLeft(suffix, "-._"), "-")
+
+	switch {
+	case prereleaseRegexp.MatchString(tokens[0]):
+		v.Prerelease = tokens[0]
+		tokens = tokens[1:]
+	case numericRegexp.MatchString(tokens[0]):
+		// Packaging revisions like 1.2.3-1 do not change the upstream version
+		if v.Build != "" {
+			v.Build = tokens[0] + "." + v.Build
+		} else {
+			v.Build = tokens[0]
+		}
+		tokens = tokens[1:]
+	}
+	v.Variant = strings.Join(tokens, "-")
+
+	return v, nil
+}
+
+func (v Version) number(i int) int {
+	if i < len(v.Numbers) {
+		return v.Numbers[i]
+	}
+	return 0
+}
+
+// IsPrerelease reports whether v is an alpha, beta, rc or similar release.
+func (v Version) IsPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// Compare returns 1 if v > o, -1 if v < o and 0 if both are equal.
+func (v Version) Compare(o Version) int {
+	n := max(len(v.Numbers), len(o.Numbers))
+	for i := 0; i < n; i++ {
+		if c := compareInt(v.number(i), o.number(i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case v.Prerelease == "" && o.Prerelease != "":
+		return 1
+	case v.Prerelease != "" && o.Prerelease == "":
+		return -1
+	case v.Prerelease != o.Prerelease:
+		return comparePrerelease(v.Prerelease, o.Prerelease)
+	}
+
+	return compareNatural(v.Build, o.Build)
+}
+
+// Compare compares two tags. Tags that are not versions sort below versions.
+func Compare(a, b string) int {
+	va, errA := Parse(a)
+	vb, errB := Parse(b)
+
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+
+	if c := va.Compare(vb); c != 0 {
+		return c
+	}
+	// Prefer the plain tag over its variants, then order variants by name
+	switch {
+	case va.Variant == "" && vb.Variant != "":
+		return 1
+	case va.Variant != "" && vb.Variant == "":
+		return -1
+	}
+	return strings.Compare(vb.Variant, va.Variant)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
+
+// comparePrerelease compares dot separated identifiers, so rc.2 < rc.10.
+func comparePrerelease(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if c := compareNatural(pa[i], pb[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(pa), len(pb))
+}
+
+// compareNatural compares strings treating runs of digits as numbers, so
+// rc2 < rc10.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		da, ra := splitDigits(a)
+		db, rb := splitDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.Atoi(da)
+			nb, _ := strconv.Atoi(db)
+			if c := compareInt(na, nb); c != 0 {
+				return c
+			}
+			a, b = ra, rb
+			continue
+		}
+
+		if c := strings.Compare(a[:1], b[:1]); c != 0 {
+			return c
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareInt(len(a), len(b))
+}
+
+func splitDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,106 @@
+package semver
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in         string
+		numbers    int
+		prerelease string
+		variant    string
+	}{
+		{"1.2.3", 3, "", ""},
+		{"v1.29", 2, "", ""},
+		{"1.2.3-rc1", 3, "rc1", ""},
+		{"1.2.3rc1", 3, "rc1", ""},
+		{"3.12.1-alpine3.19", 3, "", "alpine3.19"},
+		{"20.9-bookworm", 2, "", "bookworm"},
+		{"3.13.0-beta.2-slim", 3, "beta.2", "slim"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := Parse(tt.in)
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(v.Numbers) != tt.numbers || v.Prerelease != tt.prerelease || v.Variant != tt.variant {
+				t.Errorf("unexpected parse result %+v", v)
+			}
+		})
+	}
+
+	if _, err := Parse("latest"); err == nil {
+		t.Error("expected error for non-version tag")
+	}
+}
+
+func TestCompareOrdering(t *testing.T) {
+	tags := []string{"1.2.3", "20.9-bookworm", "1.2.3-rc1", "latest", "20.10", "1.2.3-rc10", "1.2.3-rc2", "1.10.0", "1.2.3-alpine"}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return Compare(tags[i], tags[j]) > 0
+	})
+
+	expected := []string{"20.10", "20.9-bookworm", "1.10.0", "1.2.3", "1.2.3-alpine", "1.2.3-rc10", "1.2.3-rc2", "1.2.3-rc1", "latest"}
+	for i := range expected {
+		if tags[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, tags)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	available := []string{"1.28.4", "1.29.0", "1.29.3", "1.30.0-rc1", "2.0.0", "3.11.2", "3.11.9", "3.12.0", "0.3.1", "0.4.0",
+		"16.1", "16.2-alpine", "16-bookworm", "16.1-alpine", "17-alpine"}
+
+	tests := []struct {
+		constraint string
+		expected   string
+		wantErr    bool
+	}{
+		{"latest", "16.1", false},
+		{"^1.29", "1.29.3", false},
+		{"^1", "1.29.3", false},
+		{"~3.11", "3.11.9", false},
+		{"1.x", "1.29.3", false},
+		{">=1.28 <1.29", "1.28.4", false},
+		{"^0.3", "0.3.1", false},
+		{"^1.30.0-rc1", "1.30.0-rc1", false},
+		{"^1.28 || ^3", "3.12.0", false},
+		{"^4", "", true},
+		{"^16", "16.1", false},
+		{"^16-alpine", "16.2-alpine", false},
+		{"^17", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			got, err := Resolve(tt.constraint, available)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	for _, s := range []string{"latest", "^1.29", "~3.11", "1.x", ">=1.2"} {
+		if !IsConstraint(s) {
+			t.Errorf("expected %q to be a constraint", s)
+		}
+	}
+	for _, s := range []string{"1.29.0", "3", "20-bookworm"} {
+		if IsConstraint(s) {
+			t.Errorf("expected %q to be a literal tag", s)
+		}
+	}
+}